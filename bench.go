@@ -0,0 +1,127 @@
+package ledge
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MetricReporter is the part of *testing.B that ReportToBenchmark uses, so
+// that ledge does not import package testing.
+type MetricReporter interface {
+	ReportMetric(n float64, unit string)
+}
+
+// ReportToBenchmark reports tag's mean and p99 as custom metrics of b, usually
+// a *testing.B, so they appear in go test -bench output and can be compared
+// with benchstat.
+func (l *Ledge) ReportToBenchmark(b MetricReporter, tag string) {
+	if l == nil {
+		return
+	}
+	s, ok := l.summary(tag)
+	if !ok {
+		return
+	}
+	b.ReportMetric(s.Mean, "ms/op")
+	b.ReportMetric(s.P99, "p99-ms/op")
+}
+
+// WriteBenchFormat writes each tag as a Go benchmark result line,
+//
+//	Benchmark<tag>-1 <count> <mean> ms/op
+//
+// so that benchstat can compare the output of two runs. Characters not valid
+// in a benchmark name are replaced with underscores.
+func (l *Ledge) WriteBenchFormat(w io.Writer) error {
+	if l == nil {
+		return nil
+	}
+	for _, tag := range l.tags() {
+		s, ok := l.summary(tag)
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "Benchmark%s-1\t%d\t%s ms/op\n", benchName(tag), s.Count, strconv.FormatFloat(s.Mean, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchName turns tag into a valid benchmark identifier.
+func benchName(tag string) string {
+	name := []rune(tag)
+	for i, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			name[i] = '_'
+		}
+	}
+	if len(name) > 0 {
+		name[0] = unicode.ToUpper(name[0])
+	}
+	return string(name)
+}
+
+// TestingT is the part of *testing.T and *testing.B that WithTestLogger uses.
+type TestingT interface {
+	Logf(format string, args ...interface{})
+}
+
+// testWriter forwards each line written to it to a test's log.
+type testWriter struct {
+	t TestingT
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Logf("%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// WithTestLogger sends all of l's output to t.Logf, so it is attributed to
+// the running test and only shown on failure or with -v. Color is turned off.
+// Call it before l is shared.
+func (l *Ledge) WithTestLogger(t TestingT) *Ledge {
+	l.ColorOff()
+	return l.WithOutput(testWriter{t}, testWriter{t})
+}
+
+// WriteGoBaseline writes the summaries of all tags as Go source declaring
+//
+//	var <varName> = map[string]ledge.StatsSummary{...}
+//
+// with floats at full precision, for committing as a baseline to later pass
+// to PrintCompare. Infinite and NaN values are written as calls to math.Inf
+// and math.NaN, so the file must then import math.
+func (l *Ledge) WriteGoBaseline(w io.Writer, varName string) error {
+	if l == nil {
+		return nil
+	}
+	f := func(v float64) string {
+		switch {
+		case math.IsInf(v, 1):
+			return "math.Inf(1)"
+		case math.IsInf(v, -1):
+			return "math.Inf(-1)"
+		case math.IsNaN(v):
+			return "math.NaN()"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "var %s = map[string]ledge.StatsSummary{\n", varName)
+	for _, tag := range l.tags() {
+		s, ok := l.summary(tag)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s: {Count: %d, Min: %s, Median: %s, P99: %s, Max: %s, Mean: %s, Variance: %s},\n",
+			strconv.Quote(tag), s.Count, f(s.Min), f(s.Median), f(s.P99), f(s.Max), f(s.Mean), f(s.Variance))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,189 @@
+package ledge
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReportToBenchmark(t *testing.T) {
+	l, _, _ := newTestLedge()
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	l.RecordBatch("op", values)
+	result := testing.Benchmark(func(b *testing.B) {
+		l.ReportToBenchmark(b, "op")
+	})
+	if got := result.Extra["ms/op"]; got != 50.5 {
+		t.Errorf("ms/op = %v, want 50.5", got)
+	}
+	if got := result.Extra["p99-ms/op"]; got != 99 {
+		t.Errorf("p99-ms/op = %v, want 99", got)
+	}
+}
+
+func TestReportToBenchmarkEmpty(t *testing.T) {
+	l, _, _ := newTestLedge()
+	result := testing.Benchmark(func(b *testing.B) {
+		l.ReportToBenchmark(b, "none")
+	})
+	if len(result.Extra) != 0 {
+		t.Errorf("reported %v for a tag without samples", result.Extra)
+	}
+}
+
+// benchLine matches a Go benchmark result line as benchstat parses it.
+var benchLine = regexp.MustCompile(`^Benchmark(\w+)-(\d+)\s+(\d+)\s+(\S+) ms/op$`)
+
+func TestWriteBenchFormat(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("http.get", []float64{1, 2, 3})
+	l.RecordBatch("db query", []float64{10, 20})
+	var buf bytes.Buffer
+	if err := l.WriteBenchFormat(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]float64{
+		"Http_get": {3, 2},
+		"Db_query": {2, 15},
+	}
+	got := lines(&buf)
+	if len(got) != len(want) {
+		t.Fatalf("got %q", got)
+	}
+	for _, line := range got {
+		m := benchLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("line %q is not in benchmark format", line)
+			continue
+		}
+		w, ok := want[m[1]]
+		if !ok {
+			t.Errorf("unexpected benchmark %q", m[1])
+			continue
+		}
+		count, _ := strconv.Atoi(m[3])
+		mean, err := strconv.ParseFloat(m[4], 64)
+		if err != nil || float64(count) != w[0] || mean != w[1] {
+			t.Errorf("%s: count %s mean %s, want %v", m[1], m[3], m[4], w)
+		}
+	}
+}
+
+func TestBenchName(t *testing.T) {
+	for tag, want := range map[string]string{
+		"op":       "Op",
+		"http.get": "Http_get",
+		"a/b c-d":  "A_b_c_d",
+		"größe_1":  "Größe_1",
+		"":         "",
+	} {
+		if got := benchName(tag); got != want {
+			t.Errorf("benchName(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+// fakeT is a TestingT that keeps what is logged to it.
+type fakeT struct {
+	logs []string
+}
+
+func (t *fakeT) Logf(format string, args ...interface{}) {
+	t.logs = append(t.logs, fmt.Sprintf(format, args...))
+}
+
+func TestWithTestLogger(t *testing.T) {
+	ft := &fakeT{}
+	l := New("test").WithTestLogger(ft)
+	l.StatsOn()
+	l.Println("hello")
+	l.Errorf("bad %d", 1)
+	l.RecordValue("a", 1)
+	l.Count("a")
+	if len(ft.logs) != 3 {
+		t.Fatalf("logged %q", ft.logs)
+	}
+	for i, want := range []string{"hello", "[ERROR] bad 1", "[COUNT a] 1"} {
+		if !strings.Contains(ft.logs[i], want) {
+			t.Errorf("log %q lacks %q", ft.logs[i], want)
+		}
+		if strings.Contains(ft.logs[i], "\x1b[") || strings.HasSuffix(ft.logs[i], "\n") {
+			t.Errorf("log %q has color codes or a trailing newline", ft.logs[i])
+		}
+	}
+}
+
+func TestWriteGoBaseline(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("op", []float64{0.1, 0.2, 1.0 / 3})
+	l.RecordBatch(`say "hi"`, []float64{7})
+	var buf bytes.Buffer
+	if err := l.WriteGoBaseline(&buf, "baseline"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "baseline.go", "package p\n"+buf.String(), 0)
+	if err != nil {
+		t.Fatalf("output does not parse: %v\n%s", err, buf.String())
+	}
+	spec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	if spec.Names[0].Name != "baseline" {
+		t.Errorf("declared %s, want baseline", spec.Names[0].Name)
+	}
+	got := make(map[string]StatsSummary)
+	for _, elt := range spec.Values[0].(*ast.CompositeLit).Elts {
+		kv := elt.(*ast.KeyValueExpr)
+		tag, _ := strconv.Unquote(kv.Key.(*ast.BasicLit).Value)
+		var s StatsSummary
+		v := reflect.ValueOf(&s).Elem()
+		for _, field := range kv.Value.(*ast.CompositeLit).Elts {
+			fkv := field.(*ast.KeyValueExpr)
+			f := v.FieldByName(fkv.Key.(*ast.Ident).Name)
+			lit := fkv.Value.(*ast.BasicLit).Value
+			if f.Kind() == reflect.Int {
+				n, _ := strconv.Atoi(lit)
+				f.SetInt(int64(n))
+			} else {
+				x, _ := strconv.ParseFloat(lit, 64)
+				f.SetFloat(x)
+			}
+		}
+		got[tag] = s
+	}
+	if want := l.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("baseline decodes to %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteGoBaselineNonFinite(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordValue("inf", 1)
+	l.RecordValue("inf", math.Inf(1))
+	l.RecordValue("neg", math.Inf(-1))
+	var buf bytes.Buffer
+	if err := l.WriteGoBaseline(&buf, "baseline"); err != nil {
+		t.Fatal(err)
+	}
+	src := "package p\n\nimport \"math\"\n\n" + buf.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "baseline.go", src, 0); err != nil {
+		t.Fatalf("output does not parse: %v\n%s", err, buf.String())
+	}
+	for _, want := range []string{"Max: math.Inf(1)", "Min: math.Inf(-1)", "Variance: math.NaN()"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("baseline lacks %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "+Inf") {
+		t.Errorf("baseline has a bare +Inf:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,113 @@
+package ledge
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// bufferedWriter batches writes into a bufio.Writer that is flushed when full
+// and every interval.
+type bufferedWriter struct {
+	lock *sync.Mutex
+	buf  *bufio.Writer
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newBufferedWriter(w io.Writer, size int, interval time.Duration) *bufferedWriter {
+	b := &bufferedWriter{
+		lock: &sync.Mutex{},
+		buf:  bufio.NewWriterSize(w, size),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go b.flushEvery(interval)
+	return b
+}
+
+func (b *bufferedWriter) flushEvery(interval time.Duration) {
+	defer close(b.done)
+	if interval <= 0 {
+		<-b.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *bufferedWriter) Flush() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Flush()
+}
+
+func (b *bufferedWriter) Close() error {
+	close(b.stop)
+	<-b.done
+	return b.Flush()
+}
+
+// WithBufferedWriter buffers up to size bytes of output per stream, flushing
+// when the buffer fills and every flushInterval (never, if flushInterval is
+// zero). Call Flush or Close before exiting or buffered lines are lost.
+func (l *Ledge) WithBufferedWriter(size int, flushInterval time.Duration) *Ledge {
+	for _, logger := range []*log.Logger{l.stdout, l.stderr} {
+		b := newBufferedWriter(logger.Writer(), size, flushInterval)
+		logger.SetOutput(b)
+		l.buffers = append(l.buffers, b)
+	}
+	return l
+}
+
+// Flush writes out any buffered output.
+func (l *Ledge) Flush() error {
+	if l == nil {
+		return nil
+	}
+	var err error
+	for _, b := range l.buffers {
+		if e := b.Flush(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Close stops background work such as exporters and buffer flushing, and
+// flushes any buffered output. l must not be logged to afterwards.
+func (l *Ledge) Close() error {
+	if l == nil {
+		return nil
+	}
+	var err error
+	for _, stop := range l.stoppers {
+		if e := stop(); e != nil && err == nil {
+			err = e
+		}
+	}
+	l.stoppers = nil
+	for _, b := range l.buffers {
+		if e := b.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	l.buffers = nil
+	return err
+}
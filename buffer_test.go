@@ -0,0 +1,92 @@
+package ledge
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to read while a flusher writes to it.
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestBufferedWriterClose(t *testing.T) {
+	out := &lockedBuffer{}
+	l := New("buf").WithOutput(out, out).WithBufferedWriter(1<<20, 0)
+	l.ColorOff()
+	const n = 1000
+	for i := 0; i < n; i++ {
+		l.Printf("line %d", i)
+	}
+	if out.String() != "" {
+		t.Error("output was written before the buffer filled or was flushed")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(got) != n {
+		t.Fatalf("got %d lines after Close, want %d", len(got), n)
+	}
+	for i, line := range got {
+		if !strings.HasSuffix(line, fmt.Sprintf("line %d", i)) {
+			t.Fatalf("line %d is %q", i, line)
+		}
+	}
+}
+
+func TestBufferedWriterFlushesWhenFull(t *testing.T) {
+	out := &lockedBuffer{}
+	l := New().WithOutput(out, out).WithBufferedWriter(64, 0)
+	defer l.Close()
+	for i := 0; i < 10; i++ {
+		l.Printf("a line long enough to fill the buffer quickly")
+	}
+	if out.String() == "" {
+		t.Error("nothing written after overfilling the buffer")
+	}
+}
+
+func TestBufferedWriterFlushInterval(t *testing.T) {
+	out := &lockedBuffer{}
+	l := New().WithOutput(out, out).WithBufferedWriter(1<<20, 5*time.Millisecond)
+	defer l.Close()
+	l.Printf("tick")
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "tick") {
+		if time.Now().After(deadline) {
+			t.Fatal("line not flushed by the interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	out := &lockedBuffer{}
+	l := New().WithOutput(out, out).WithBufferedWriter(1<<20, 0)
+	defer l.Close()
+	l.Errorf("oops")
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "oops") {
+		t.Errorf("Flush left %q", out.String())
+	}
+}
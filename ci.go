@@ -0,0 +1,56 @@
+package ledge
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/montanaflynn/stats"
+)
+
+// MeanCI returns the mean of tag with its confidence interval, confidence in
+// (0,1) (e.g. 0.95), using Student's t distribution with the sample standard
+// deviation. ok is false for fewer than two samples or an invalid confidence.
+func (l *Ledge) MeanCI(tag string, confidence float64) (mean, lower, upper float64, ok bool) {
+	records := l.samples(tag)
+	if len(records) < 2 || !(confidence > 0 && confidence < 1) {
+		return 0, 0, 0, false
+	}
+	mean, _ = stats.Mean(records)
+	sd, _ := stats.StandardDeviationSample(records)
+	n := float64(len(records))
+	margin := studentT(1-(1-confidence)/2, n-1) * sd / math.Sqrt(n)
+	return mean, mean - margin, mean + margin, true
+}
+
+func (l *Ledge) PrintMeanCI(tag string, confidence float64) {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		mean, lower, upper, ok := l.MeanCI(tag, confidence)
+		if !ok {
+			return
+		}
+		tagString := fmt.Sprintf("[MEAN-CI%s %s]", strconv.FormatFloat(confidence*100, 'f', -1, 64), tag)
+		l.emitStat(tagString, fmt.Sprintf("%f [%f, %f]", mean, lower, upper))
+	}
+}
+
+// studentT returns the p quantile of Student's t distribution with df degrees
+// of freedom: exactly for one and two, otherwise by a Cornish-Fisher
+// expansion around the normal quantile.
+func studentT(p, df float64) float64 {
+	switch df {
+	case 1:
+		return math.Tan(math.Pi * (p - 0.5))
+	case 2:
+		return (2*p - 1) / math.Sqrt(2*p*(1-p))
+	}
+	z := stats.NormPpf(p, 0, 1)
+	z3, z5, z7 := math.Pow(z, 3), math.Pow(z, 5), math.Pow(z, 7)
+	return z +
+		(z3+z)/(4*df) +
+		(5*z5+16*z3+3*z)/(96*df*df) +
+		(3*z7+19*z5+17*z3-15*z)/(384*df*df*df)
+}
@@ -0,0 +1,67 @@
+package ledge
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMeanCI(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	mean, lower, upper, ok := l.MeanCI("a", 0.95)
+	if !ok || mean != 5.5 {
+		t.Fatalf("MeanCI = %v, %v, %v, %v", mean, lower, upper, ok)
+	}
+	// t(0.975, 9) = 2.262157, sample sd = 3.027650, so the margin is 2.165806.
+	if math.Abs(lower-3.334194) > 1e-3 || math.Abs(upper-7.665806) > 1e-3 {
+		t.Errorf("95%% interval [%v, %v], want about [3.334194, 7.665806]", lower, upper)
+	}
+	_, lower99, upper99, _ := l.MeanCI("a", 0.99)
+	_, lower80, upper80, _ := l.MeanCI("a", 0.80)
+	if !(lower99 < lower && lower < lower80 && lower80 < mean && mean < upper80 && upper80 < upper && upper < upper99) {
+		t.Errorf("intervals do not nest: 80%% [%v, %v], 95%% [%v, %v], 99%% [%v, %v]", lower80, upper80, lower, upper, lower99, upper99)
+	}
+}
+
+func TestMeanCIInvalid(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("one", []float64{1})
+	l.RecordBatch("two", []float64{1, 3})
+	for _, tc := range []struct {
+		tag        string
+		confidence float64
+	}{{"one", 0.95}, {"none", 0.95}, {"two", 0}, {"two", 1}, {"two", 95}} {
+		if _, _, _, ok := l.MeanCI(tc.tag, tc.confidence); ok {
+			t.Errorf("MeanCI(%q, %v) reported ok", tc.tag, tc.confidence)
+		}
+	}
+}
+
+func TestStudentT(t *testing.T) {
+	for _, tc := range []struct {
+		p, df, want float64
+	}{
+		{0.975, 1, 12.706205},
+		{0.975, 2, 4.302653},
+		{0.975, 9, 2.262157},
+		{0.975, 30, 2.042272},
+		{0.995, 10, 3.169273},
+		{0.95, 100, 1.660234},
+	} {
+		if got := studentT(tc.p, tc.df); math.Abs(got-tc.want) > tc.want*0.005 {
+			t.Errorf("studentT(%v, %v) = %v, want %v", tc.p, tc.df, got, tc.want)
+		}
+	}
+}
+
+func TestPrintMeanCI(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1, 3})
+	l.PrintMeanCI("a", 0.95)
+	l.PrintMeanCI("none", 0.95)
+	got := lines(stdout)
+	if len(got) != 1 || !strings.Contains(got[0], "[MEAN-CI95 a] 2.000000 [") {
+		t.Errorf("PrintMeanCI printed %q", got)
+	}
+}
@@ -0,0 +1,68 @@
+package ledge
+
+import (
+	"time"
+)
+
+// DefaultTimeFormat is the layout of text-mode timestamps unless changed with
+// WithTimeFormat.
+const DefaultTimeFormat = "15:04:05.000000"
+
+// Clock is the source of the timestamps ledge writes.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock makes l take its timestamps from c. Call it before l is shared.
+func (l *Ledge) WithClock(c Clock) *Ledge {
+	l.clock = c
+	return l
+}
+
+// WithTimeFormat sets the time.Format layout of text-mode timestamps. Call it
+// before l is shared.
+func (l *Ledge) WithTimeFormat(layout string) *Ledge {
+	l.timeFormat = layout
+	return l
+}
+
+// WithUTC writes timestamps in UTC instead of local time, in both text and
+// JSON mode. Call it before l is shared.
+func (l *Ledge) WithUTC() *Ledge {
+	l.utc = true
+	return l
+}
+
+// now is the timestamp for a line being written.
+func (l *Ledge) now() time.Time {
+	t := l.clock.Now()
+	if l.utc {
+		t = t.UTC()
+	}
+	return t
+}
+
+// Tick records into tag the time since the previous Tick on tag, measured
+// with l's clock, capturing the inter-arrival distribution of events. The
+// first Tick on a tag only starts the clock.
+func (l *Ledge) Tick(tag string) {
+	if l == nil {
+		return
+	}
+	if l.stats.IsSet() {
+		now := l.clock.Now()
+		l.recordsLock.Lock()
+		last, ok := l.ticks[tag]
+		l.ticks[tag] = now
+		l.recordsLock.Unlock()
+		if ok {
+			l.recordElapsed(tag, now.Sub(last))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ledge
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zonedClock returns a fixed instant in UTC+5.
+type zonedClock struct{}
+
+func (zonedClock) Now() time.Time {
+	return time.Date(2021, 6, 1, 17, 30, 0, 0, time.FixedZone("X", 5*60*60))
+}
+
+func TestWithUTC(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithClock(zonedClock{}).WithTimeFormat(time.RFC3339)
+	l.Printf("local")
+	l.WithUTC()
+	l.Printf("utc")
+	got := lines(stdout)
+	if !strings.HasPrefix(got[0], "2021-06-01T17:30:00+05:00 ") {
+		t.Errorf("local line %q", got[0])
+	}
+	if !strings.HasPrefix(got[1], "2021-06-01T12:30:00Z ") {
+		t.Errorf("UTC line %q", got[1])
+	}
+}
+
+func TestWithUTCJSON(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithClock(zonedClock{}).WithUTC()
+	l.JSONOn()
+	l.Printf("x")
+	var record jsonRecord
+	if err := json.Unmarshal(stdout.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Time != "2021-06-01T12:30:00Z" {
+		t.Errorf("time = %q, want UTC", record.Time)
+	}
+}
+
+func TestDefaultTimeFormat(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithClock(zonedClock{})
+	l.Printf("x")
+	if !strings.HasPrefix(stdout.String(), "17:30:00.000000 [test] x") {
+		t.Errorf("line %q", stdout.String())
+	}
+}
+
+func TestTick(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock)
+	l.Tick("arrivals")
+	if got := l.samples("arrivals"); len(got) != 0 {
+		t.Fatalf("first Tick recorded %v", got)
+	}
+	for _, gap := range []time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 5 * time.Millisecond} {
+		clock.Advance(gap)
+		l.Tick("arrivals")
+	}
+	clock.Advance(time.Second)
+	l.Tick("other")
+	if !equalFloats(l.samples("arrivals"), []float64{10, 30, 5}) {
+		t.Errorf("gaps = %v, want [10 30 5]", l.samples("arrivals"))
+	}
+	if got := l.samples("other"); len(got) != 0 {
+		t.Errorf("first Tick on another tag recorded %v", got)
+	}
+}
+
+func TestTickStatsOff(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock).StatsOff()
+	l.Tick("arrivals")
+	clock.Advance(time.Second)
+	l.Tick("arrivals")
+	if got := l.samples("arrivals"); len(got) != 0 {
+		t.Errorf("recorded %v with stats off", got)
+	}
+}
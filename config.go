@@ -0,0 +1,86 @@
+package ledge
+
+import (
+	"sort"
+	"time"
+)
+
+// Config is a snapshot of how a Ledge is configured, suitable for
+// json.Marshal alongside exported results.
+type Config struct {
+	Prefix           string        `json:"prefix,omitempty"`
+	Service          string        `json:"service,omitempty"`
+	ProcessMetadata  bool          `json:"process_metadata"`
+	Debug            bool          `json:"debug"`
+	Stats            bool          `json:"stats"`
+	Reporting        bool          `json:"reporting"`
+	JSON             bool          `json:"json"`
+	Color            bool          `json:"color"`
+	UTC              bool          `json:"utc"`
+	TimeFormat       string        `json:"time_format"`
+	StatsPrefix      bool          `json:"stats_prefix"`
+	StatsMarker      string        `json:"stats_marker,omitempty"`
+	StatsOrder       []string      `json:"stats_order"`
+	MinSamples       int           `json:"min_samples,omitempty"`
+	Locking          bool          `json:"locking"`
+	Buffered         bool          `json:"buffered"`
+	TagNormalizer    bool          `json:"tag_normalizer"`
+	InstantThreshold time.Duration `json:"instant_threshold,omitempty"`
+	MemoryBudget     int           `json:"memory_budget,omitempty"`
+	RollupInterval   time.Duration `json:"rollup_interval,omitempty"`
+	Sketches         []string      `json:"sketches,omitempty"`
+	StrictKinds      bool          `json:"strict_kinds"`
+	StatsOnPanic     bool          `json:"stats_on_panic"`
+	CheckStackTrace  bool          `json:"check_stack_trace"`
+	MaxLineLength    int           `json:"max_line_length,omitempty"`
+	MaxPlausible     time.Duration `json:"max_plausible,omitempty"`
+	DropImplausible  bool          `json:"drop_implausible"`
+	TimerLeaks       bool          `json:"timer_leak_detection"`
+	AutoSummary      int           `json:"auto_summary,omitempty"`
+	RandSeed         int64         `json:"rand_seed,omitempty"`
+}
+
+// Config returns a snapshot of l's current configuration.
+func (l *Ledge) Config() Config {
+	_, unlocked := l.recordsLock.(noLock)
+	c := Config{
+		Prefix:           l.name,
+		Service:          l.service,
+		ProcessMetadata:  l.pid != 0,
+		Debug:            l.debug.IsSet(),
+		Stats:            l.stats.IsSet(),
+		Reporting:        l.reporting.IsSet(),
+		JSON:             l.json.IsSet(),
+		Color:            l.color.IsSet(),
+		UTC:              l.utc,
+		TimeFormat:       l.timeFormat,
+		StatsPrefix:      l.labelPrefix,
+		StatsMarker:      l.statsMarker,
+		MinSamples:       l.minSamples,
+		Locking:          !unlocked,
+		Buffered:         len(l.buffers) > 0,
+		TagNormalizer:    l.normalizer != nil,
+		InstantThreshold: l.instantThreshold,
+		MemoryBudget:     l.memoryBudget,
+		RollupInterval:   l.rollupInterval,
+		StrictKinds:      l.strictKinds,
+		StatsOnPanic:     l.statsOnPanic,
+		CheckStackTrace:  l.checkStackTrace,
+		MaxLineLength:    l.maxLineLength,
+		MaxPlausible:     l.maxPlausible,
+		DropImplausible:  l.dropImplausible,
+		TimerLeaks:       l.timerLeakDetection,
+		AutoSummary:      l.autoSummary,
+		RandSeed:         l.randSeed,
+	}
+	for _, m := range l.statsOrder {
+		c.StatsOrder = append(c.StatsOrder, m.String())
+	}
+	l.recordsLock.RLock()
+	for tag := range l.sketches {
+		c.Sketches = append(c.Sketches, tag)
+	}
+	l.recordsLock.RUnlock()
+	sort.Strings(c.Sketches)
+	return c
+}
@@ -0,0 +1,75 @@
+package ledge
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithServiceName("svc").
+		WithUTC().
+		WithTimeFormat(time.RFC3339).
+		WithStatsOrder(MetricMean, MetricCount).
+		WithMinSamples(5).
+		WithStatsMarker("--").
+		WithTagNormalizer(strings.ToLower).
+		WithSketch("Lat").
+		WithMaxLineLength(100).
+		WithMaxPlausible(time.Hour, true).
+		WithRollup(time.Minute).
+		WithStatsOnPanic().
+		WithStatsPrefix(true).
+		WithRandSeed(7)
+	l.JSONOn()
+	got := l.Config()
+	want := Config{
+		Prefix:          "test",
+		Service:         "svc",
+		Stats:           true,
+		Reporting:       true,
+		JSON:            true,
+		UTC:             true,
+		TimeFormat:      time.RFC3339,
+		StatsPrefix:     true,
+		StatsMarker:     "--",
+		StatsOrder:      []string{"mean", "count"},
+		MinSamples:      5,
+		Locking:         true,
+		TagNormalizer:   true,
+		RollupInterval:  time.Minute,
+		Sketches:        []string{"lat"},
+		StatsOnPanic:    true,
+		MaxLineLength:   100,
+		MaxPlausible:    time.Hour,
+		DropImplausible: true,
+		RandSeed:        7,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Config() = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestConfigJSON(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithoutLocking().WithMemoryBudget(1 << 20)
+	b, err := json.Marshal(l.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Config
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, l.Config()) {
+		t.Errorf("round trip gave %+v, want %+v", back, l.Config())
+	}
+	for _, key := range []string{`"locking":false`, `"memory_budget":1048576`, `"stats":true`} {
+		if !strings.Contains(string(b), key) {
+			t.Errorf("%s lacks %s", b, key)
+		}
+	}
+}
@@ -21,7 +21,7 @@ func main() {
 	log.DebugOn()
 	log.Debugf("Show me %d", 1)
 	log.Debugln("Show me", 1)
-	// We can globally turn off debugging for all ledges
+	// Stats are off by default, so nothing is recorded and this counts 0
 	log.Record("tag1", func() {})
 	log.Count("tag1")
 	// Turn stats on
@@ -64,11 +64,12 @@ func main() {
 	// This is a convenience function which prints out basic stats
 	log.Stats("tag1")
 	log.ClearRecords("tag1")
-	fmt.Println("Should see just count 0:")
-	// This will only print a count of zero
+	fmt.Println("Should see just no samples:")
+	// This will only print that there are no samples
 	log.Stats("tag1")
-	fmt.Println("Should see just panic:")
-	// Turning stats off means no record will get recorded or printed
+	fmt.Println("Should see just no samples and panic:")
+	// Turning stats off means nothing more gets recorded, though what was
+	// already recorded can still be printed
 	log.StatsOff()
 	for i := 0; i < 50; i++ {
 		log.Record("tag1", func() {
@@ -76,6 +77,9 @@ func main() {
 		})
 	}
 	log.Stats("tag1")
+	// Turning reporting off silences the stat printing methods
+	log.ReportingOff()
+	log.Stats("tag1")
 	// Our panic
 	log.Panicf("PANICKING %f", 0.5)
 }
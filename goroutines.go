@@ -0,0 +1,20 @@
+package ledge
+
+import (
+	"runtime"
+)
+
+// RecordGoroutines runs f, recording the goroutine count beforehand into
+// tag:goroutines and how many more goroutines exist afterwards into
+// tag:goroutines-delta. A persistently positive delta suggests f leaks.
+func (l *Ledge) RecordGoroutines(tag string, f func()) {
+	before := runtime.NumGoroutine()
+	f()
+	l.RecordValue(tag+":goroutines", float64(before))
+	l.RecordValue(tag+":goroutines-delta", float64(runtime.NumGoroutine()-before))
+}
+
+// Goroutines records the current goroutine count into tag.
+func (l *Ledge) Goroutines(tag string) {
+	l.RecordValue(tag, float64(runtime.NumGoroutine()))
+}
@@ -0,0 +1,31 @@
+package ledge
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestRecordGoroutinesLeak(t *testing.T) {
+	l, _, _ := newTestLedge()
+	release := make(chan struct{})
+	defer close(release)
+	l.RecordGoroutines("leaky", func() {
+		for i := 0; i < 5; i++ {
+			go func() { <-release }()
+		}
+	})
+	if got := l.samples("leaky:goroutines-delta"); len(got) != 1 || got[0] < 5 {
+		t.Errorf("goroutines-delta = %v, want at least 5", got)
+	}
+	if got := l.samples("leaky:goroutines"); len(got) != 1 || got[0] < 1 {
+		t.Errorf("goroutines = %v", got)
+	}
+}
+
+func TestGoroutines(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.Goroutines("count")
+	if got := l.samples("count"); len(got) != 1 || got[0] < 1 || got[0] > float64(runtime.NumGoroutine()+10) {
+		t.Errorf("recorded %v goroutines", got)
+	}
+}
@@ -0,0 +1,65 @@
+package ledge
+
+import (
+	"html/template"
+	"io"
+)
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Name}}{{.Name}} {{end}}ledge report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>{{if .Name}}{{.Name}} {{end}}ledge report</h1>
+<table>
+<tr><th>tag</th><th>description</th><th>count</th><th>min</th><th>median</th><th>p99</th><th>max</th><th>mean</th><th>variance</th></tr>
+{{range .Rows}}<tr><td>{{.Tag}}</td><td>{{.Description}}</td><td>{{.Count}}</td><td>{{printf "%f" .Min}}</td><td>{{printf "%f" .Median}}</td><td>{{printf "%f" .P99}}</td><td>{{printf "%f" .Max}}</td><td>{{printf "%f" .Mean}}</td><td>{{printf "%f" .Variance}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type htmlRow struct {
+	Tag         string
+	Description string
+	StatsSummary
+}
+
+// DescribeTag sets help text for tag, shown alongside it in reports.
+func (l *Ledge) DescribeTag(tag, description string) {
+	l.recordsLock.Lock()
+	defer l.recordsLock.Unlock()
+	l.descriptions[tag] = description
+}
+
+// TagDescription returns the help text set for tag with DescribeTag, if any.
+func (l *Ledge) TagDescription(tag string) string {
+	l.recordsLock.RLock()
+	defer l.recordsLock.RUnlock()
+	return l.descriptions[tag]
+}
+
+// WriteHTMLReport writes a self-contained HTML page summarizing every tag.
+func (l *Ledge) WriteHTMLReport(w io.Writer) error {
+	if l == nil {
+		return nil
+	}
+	data := struct {
+		Name string
+		Rows []htmlRow
+	}{Name: l.name}
+	for _, tag := range l.tags() {
+		if s, ok := l.summary(tag); ok {
+			data.Rows = append(data.Rows, htmlRow{Tag: tag, Description: l.TagDescription(tag), StatsSummary: s})
+		}
+	}
+	return htmlReport.Execute(w, data)
+}
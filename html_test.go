@@ -0,0 +1,102 @@
+package ledge
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// htmlCells parses page leniently as HTML and returns the text of each table
+// row's cells.
+func htmlCells(t *testing.T, page string) [][]string {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(page))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	var rows [][]string
+	var cell *strings.Builder
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("report does not parse: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "tr":
+				rows = append(rows, nil)
+			case "td":
+				cell = &strings.Builder{}
+			}
+		case xml.CharData:
+			if cell != nil {
+				cell.Write(tok)
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "td" {
+				rows[len(rows)-1] = append(rows[len(rows)-1], cell.String())
+				cell = nil
+			}
+		}
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("db.query", []float64{1, 2, 3})
+	l.RecordBatch("<script>alert(1)</script>", []float64{4})
+	var out bytes.Buffer
+	if err := l.WriteHTMLReport(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "<script>") {
+		t.Error("tag name was not escaped")
+	}
+	rows := htmlCells(t, out.String())
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want a header and two tags: %q", len(rows), rows)
+	}
+	want := [][2]string{
+		{"<script>alert(1)</script>", "1"},
+		{"db.query", "3"},
+	}
+	for i, w := range want {
+		row := rows[i+1]
+		if len(row) < 3 || row[0] != w[0] || row[2] != w[1] {
+			t.Errorf("row %d = %q, want tag and count %q", i, row, w)
+		}
+	}
+}
+
+func TestDescribeTag(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.DescribeTag("db.query", "time to run one <query>")
+	l.RecordBatch("db.query", []float64{1})
+	l.RecordBatch("plain", []float64{2})
+	if got := l.TagDescription("db.query"); got != "time to run one <query>" {
+		t.Errorf("TagDescription = %q", got)
+	}
+	if got := l.TagDescription("plain"); got != "" {
+		t.Errorf("TagDescription of an undescribed tag = %q", got)
+	}
+	var out bytes.Buffer
+	if err := l.WriteHTMLReport(&out); err != nil {
+		t.Fatal(err)
+	}
+	rows := htmlCells(t, out.String())
+	if len(rows) != 3 || rows[0] != nil {
+		t.Fatalf("rows %q", rows)
+	}
+	if rows[1][0] != "db.query" || rows[1][1] != "time to run one <query>" {
+		t.Errorf("described row %q", rows[1])
+	}
+	if rows[2][0] != "plain" || rows[2][1] != "" {
+		t.Errorf("undescribed row %q", rows[2])
+	}
+}
@@ -0,0 +1,21 @@
+package ledge
+
+import (
+	"time"
+)
+
+// WithInstantThreshold counts timed samples shorter than threshold as
+// "instant" (for example cache hits), queryable with InstantCount. They are
+// still recorded as usual. Call it before l is shared.
+func (l *Ledge) WithInstantThreshold(threshold time.Duration) *Ledge {
+	l.instantThreshold = threshold
+	return l
+}
+
+// InstantCount returns how many of tag's timed samples were below the instant
+// threshold.
+func (l *Ledge) InstantCount(tag string) int {
+	l.recordsLock.RLock()
+	defer l.recordsLock.RUnlock()
+	return l.instants[tag]
+}
@@ -0,0 +1,43 @@
+package ledge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInstantCount(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithInstantThreshold(time.Millisecond)
+	l.RecordDurations("cache", []time.Duration{0, 10 * time.Microsecond, 999 * time.Microsecond, time.Millisecond, 50 * time.Millisecond})
+	if got := l.InstantCount("cache"); got != 3 {
+		t.Errorf("InstantCount = %d, want 3", got)
+	}
+	if got := l.count("cache"); got != 5 {
+		t.Errorf("count = %d, want instant samples recorded too", got)
+	}
+	if s, _ := l.Summary("cache"); s.Min != 0 {
+		t.Errorf("min = %v, want the zero-duration sample kept", s.Min)
+	}
+}
+
+func TestInstantCountValuesAndClear(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithInstantThreshold(time.Millisecond)
+	l.RecordValue("score", 0)
+	if got := l.InstantCount("score"); got != 0 {
+		t.Errorf("InstantCount of values = %d, want 0", got)
+	}
+	l.RecordDuration("cache", 0)
+	l.ClearRecords("cache")
+	if got := l.InstantCount("cache"); got != 0 {
+		t.Errorf("InstantCount after ClearRecords = %d", got)
+	}
+}
+
+func TestInstantCountDisabled(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordDuration("cache", 0)
+	if got := l.InstantCount("cache"); got != 0 {
+		t.Errorf("InstantCount without a threshold = %d", got)
+	}
+}
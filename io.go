@@ -0,0 +1,83 @@
+package ledge
+
+import (
+	"io"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// RecordIO times f, which transfers bytes, recording the duration into tag
+// and the byte count into tag:bytes. The duration is measured with l's clock.
+func (l *Ledge) RecordIO(tag string, bytes int64, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	defer l.enter(tag).exit()
+	t0 := l.clock.Now()
+	f()
+	if l.stats.IsSet() {
+		l.recordElapsed(tag, l.clock.Now().Sub(t0))
+		l.record(tag+":bytes", kindValue, float64(bytes))
+	}
+}
+
+// Bandwidth returns the throughput, in MB/s, of everything recorded into tag
+// with RecordIO, or false if nothing measurable was recorded.
+func (l *Ledge) Bandwidth(tag string) (float64, bool) {
+	millis, _ := stats.Sum(l.samples(tag))
+	bytes, _ := stats.Sum(l.samples(tag + ":bytes"))
+	if !(millis > 0) {
+		return 0, false
+	}
+	return bytes / 1e6 / (millis / float64(time.Second/time.Millisecond)), true
+}
+
+// timedReader records time to first byte and total read time of a reader.
+type timedReader struct {
+	l         *Ledge
+	tag       string
+	r         io.Reader
+	start     time.Time
+	firstByte bool
+	done      bool
+}
+
+// TimedReader wraps r, recording into tag:ttfb the time from this call until
+// the first Read that returns data, and into tag:total the time until Read
+// returns io.EOF or the reader is closed. The returned reader implements
+// io.Closer, closing r if it is one.
+func (l *Ledge) TimedReader(tag string, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &timedReader{l: l, tag: tag, r: r, start: l.clock.Now()}
+}
+
+func (t *timedReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 && !t.firstByte {
+		t.firstByte = true
+		t.l.RecordDuration(t.tag+":ttfb", t.l.clock.Now().Sub(t.start))
+	}
+	if err == io.EOF {
+		t.finish()
+	}
+	return n, err
+}
+
+func (t *timedReader) Close() error {
+	t.finish()
+	if c, ok := t.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (t *timedReader) finish() {
+	if !t.done {
+		t.done = true
+		t.l.RecordDuration(t.tag+":total", t.l.clock.Now().Sub(t.start))
+	}
+}
@@ -0,0 +1,105 @@
+package ledge
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRecordIOBandwidth(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock)
+	l.RecordIO("copy", 10e6, func() { clock.Advance(time.Second) })
+	l.RecordIO("copy", 20e6, func() { clock.Advance(3 * time.Second) })
+	if got := l.samples("copy"); !equalFloats(got, []float64{1000, 3000}) {
+		t.Errorf("durations = %v", got)
+	}
+	if got := l.samples("copy:bytes"); !equalFloats(got, []float64{10e6, 20e6}) {
+		t.Errorf("bytes = %v", got)
+	}
+	if mbps, ok := l.Bandwidth("copy"); !ok || mbps != 7.5 {
+		t.Errorf("Bandwidth = %v, %v, want 7.5 MB/s", mbps, ok)
+	}
+}
+
+func TestBandwidthNoTime(t *testing.T) {
+	l, _, _ := newTestLedge()
+	if _, ok := l.Bandwidth("none"); ok {
+		t.Error("Bandwidth of an unrecorded tag reported ok")
+	}
+	l.WithClock(newFakeClock())
+	l.RecordIO("instant", 100, func() {})
+	if _, ok := l.Bandwidth("instant"); ok {
+		t.Error("Bandwidth over zero time reported ok")
+	}
+}
+
+// slowReader returns chunks in turn, advancing clock by the matching delay
+// before each Read, and then io.EOF.
+type slowReader struct {
+	clock  *fakeClock
+	delays []time.Duration
+	chunks []string
+	closed bool
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	r.clock.Advance(r.delays[0])
+	n := copy(p, r.chunks[0])
+	r.delays, r.chunks = r.delays[1:], r.chunks[1:]
+	return n, nil
+}
+
+func (r *slowReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestTimedReader(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock)
+	src := &slowReader{
+		clock:  clock,
+		delays: []time.Duration{50 * time.Millisecond, 10 * time.Millisecond, 5 * time.Millisecond},
+		chunks: []string{"", "hello", " world"},
+	}
+	b, err := ioutil.ReadAll(l.TimedReader("get", src))
+	if err != nil || string(b) != "hello world" {
+		t.Fatalf("read %q, %v", b, err)
+	}
+	if got := l.samples("get:ttfb"); !equalFloats(got, []float64{60}) {
+		t.Errorf("ttfb = %v, want [60]", got)
+	}
+	if got := l.samples("get:total"); !equalFloats(got, []float64{65}) {
+		t.Errorf("total = %v, want [65]", got)
+	}
+}
+
+func TestTimedReaderClose(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock)
+	src := &slowReader{clock: clock, delays: []time.Duration{time.Second, time.Second}, chunks: []string{"a", "b"}}
+	r := l.TimedReader("get", src)
+	r.Read(make([]byte, 1))
+	clock.Advance(time.Second)
+	if err := r.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	r.(io.Closer).Close()
+	if !src.closed {
+		t.Error("underlying reader was not closed")
+	}
+	if got := l.samples("get:total"); !equalFloats(got, []float64{2000}) {
+		t.Errorf("total = %v, want one sample of 2000", got)
+	}
+	if got := l.count("get:ttfb"); got != 1 {
+		t.Errorf("ttfb holds %d samples, want 1", got)
+	}
+}
@@ -0,0 +1,35 @@
+package ledge
+
+// kind is what a tag's samples measure. A tag keeps the kind of its first
+// sample, and samples of another kind are rejected.
+type kind int
+
+const (
+	kindDuration kind = iota + 1
+	kindValue
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindDuration:
+		return "duration"
+	case kindValue:
+		return "value"
+	}
+	return "unknown"
+}
+
+// WithStrictKinds makes recording a sample of the wrong kind into a tag, such
+// as RecordValue into a tag used with Record, panic instead of just logging an
+// error. Call it before l is shared.
+func (l *Ledge) WithStrictKinds() *Ledge {
+	l.strictKinds = true
+	return l
+}
+
+func (l *Ledge) kindMismatch(tag string, existing, got kind) {
+	if l.strictKinds {
+		l.Panicf("tag %s holds %s samples, cannot record a %s", tag, existing, got)
+	}
+	l.Errorf("tag %s holds %s samples, rejected a %s", tag, existing, got)
+}
@@ -0,0 +1,43 @@
+package ledge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKindMismatch(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.Record("op", func() {})
+	l.RecordValue("op", 42)
+	if l.count("op") != 1 {
+		t.Errorf("count = %d, want the value rejected", l.count("op"))
+	}
+	if !strings.Contains(stderr.String(), "[ERROR] tag op holds duration samples, rejected a value") {
+		t.Errorf("mismatch not reported: %q", stderr.String())
+	}
+	stderr.Reset()
+	l.RecordValue("score", 1)
+	l.Record("score", func() {})
+	if l.count("score") != 1 || !strings.Contains(stderr.String(), "tag score holds value samples, rejected a duration") {
+		t.Errorf("count %d, stderr %q", l.count("score"), stderr.String())
+	}
+}
+
+func TestKindMismatchStrict(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithStrictKinds()
+	l.RecordValue("score", 1)
+	r := mustPanic(t, func() { l.Record("score", func() {}) })
+	if !strings.Contains(r.(string), "tag score holds value samples, cannot record a duration") {
+		t.Errorf("panic %q", r)
+	}
+}
+
+func TestKindSameKind(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.RecordValue("a", 1)
+	l.RecordValue("a", 2)
+	if stderr.Len() != 0 {
+		t.Errorf("same-kind records reported %q", stderr.String())
+	}
+}
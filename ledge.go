@@ -1,25 +1,118 @@
 package ledge
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"math/rand"
 	"os"
+	"reflect"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	. "github.com/logrusorgru/aurora/v3"
 	"github.com/montanaflynn/stats"
 	"github.com/tevino/abool"
 )
 
+// Ledge is a colorized logger and timing recorder. Its methods that log,
+// record or print stats may be called on a nil *Ledge, in which case they do
+// nothing beyond running any function they were given; the Panic, Fatal and
+// Check methods still panic or exit. Options and methods that return stats
+// need a non-nil Ledge.
 type Ledge struct {
-	records     map[string][]float64
-	recordsLock *sync.RWMutex
-	stdout      *log.Logger
-	stderr      *log.Logger
-	debug       *abool.AtomicBool
-	stats       *abool.AtomicBool
+	records      map[string][]float64
+	sources      map[string]map[string][]float64
+	instants     map[string]int
+	kinds        map[string]kind
+	sketches     map[string]*Sketch
+	ticks        map[string]time.Time
+	descriptions map[string]string
+	deltaCursors map[string]int
+	sorted       map[string][]float64
+	slo          map[string]*sloCounts
+	recordsLock  rwLocker
+	concurrency  *sync.Map
+	name         string
+	prefix       string
+	service      string
+	host         string
+	pid          int
+	labelPrefix  bool
+	stdout       *log.Logger
+	stderr       *log.Logger
+	levelWriters map[Level]*log.Logger
+	debug        *abool.AtomicBool
+	stats        *abool.AtomicBool
+	reporting    *abool.AtomicBool
+	clock        Clock
+	timeFormat   string
+	utc          bool
+	json         *abool.AtomicBool
+	color        *abool.AtomicBool
+	rand         *rand.Rand
+	randSeed     int64
+	randLock     *sync.Mutex
+	buffers      []*bufferedWriter
+	stoppers     []func() error
+
+	minSamples         int
+	statsMarker        string
+	statsOrder         []Metric
+	normalizer         func(string) string
+	instantThreshold   time.Duration
+	sampleHooks        []func(string, float64)
+	statsHooks         []func(string, StatsSummary)
+	strictKinds        bool
+	statsOnPanic       bool
+	checkStackTrace    bool
+	maxLineLength      int
+	maxPlausible       time.Duration
+	dropImplausible    bool
+	timerLeakDetection bool
+	autoSummary        int
+	autoCounts         map[string]int
+	rollupInterval     time.Duration
+	stamps             map[string][]time.Time
+	rollups            map[string][]IntervalStats
+	memoryBudget       int
+	recordedBytes      int
+	recordSeq          uint64
+	lastRecorded       map[string]uint64
+}
+
+// rwLocker guards records; it is a *sync.RWMutex unless WithoutLocking was
+// used.
+type rwLocker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+type noLock struct{}
+
+func (noLock) Lock()    {}
+func (noLock) Unlock()  {}
+func (noLock) RLock()   {}
+func (noLock) RUnlock() {}
+
+type jsonRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Service string `json:"service,omitempty"`
+	Host    string `json:"host,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	Msg     string `json:"msg"`
 }
 
 func New(prefixComponents ...string) *Ledge {
@@ -27,16 +120,108 @@ func New(prefixComponents ...string) *Ledge {
 	if len(prefixComponents) == 0 {
 		prefix = ""
 	}
+	seed := time.Now().UnixNano()
 	return &Ledge{
-		records:     make(map[string][]float64),
-		recordsLock: &sync.RWMutex{},
-		stdout:      log.New(os.Stdout, fmt.Sprintf("%s", Green(prefix)), log.Lmsgprefix|log.Lmicroseconds),
-		stderr:      log.New(os.Stderr, fmt.Sprintf("%s", BrightRed(prefix)), log.Lmsgprefix|log.Lmicroseconds),
-		debug:       abool.NewBool(false),
-		stats:       abool.NewBool(false),
+		records:      make(map[string][]float64),
+		sources:      make(map[string]map[string][]float64),
+		instants:     make(map[string]int),
+		kinds:        make(map[string]kind),
+		sketches:     make(map[string]*Sketch),
+		ticks:        make(map[string]time.Time),
+		descriptions: make(map[string]string),
+		deltaCursors: make(map[string]int),
+		sorted:       make(map[string][]float64),
+		slo:          make(map[string]*sloCounts),
+		recordsLock:  &sync.RWMutex{},
+		concurrency:  &sync.Map{},
+		name:         strings.Join(prefixComponents, " "),
+		prefix:       prefix,
+		stdout:       log.New(os.Stdout, "", 0),
+		stderr:       log.New(os.Stderr, "", 0),
+		labelPrefix:  true,
+		statsOrder:   defaultStatsOrder,
+		clock:        realClock{},
+		timeFormat:   DefaultTimeFormat,
+		debug:        abool.NewBool(false),
+		stats:        abool.NewBool(false),
+		reporting:    abool.NewBool(true),
+		json:         abool.NewBool(false),
+		color:        abool.NewBool(true),
+		rand:         rand.New(rand.NewSource(seed)),
+		randSeed:     seed,
+		randLock:     &sync.Mutex{},
 	}
 }
 
+// WithServiceName labels l's output with the service it belongs to: in text
+// mode as a leading [name] in the prefix, and in JSON mode as a "service"
+// field. Call it before l is shared.
+func (l *Ledge) WithServiceName(name string) *Ledge {
+	l.service = name
+	l.prefix = fmt.Sprintf("[%s] %s", name, l.prefix)
+	return l
+}
+
+// WithProcessMetadata adds "host" and "pid" fields, looked up once now, to
+// every JSON line. Call it before l is shared.
+func (l *Ledge) WithProcessMetadata() *Ledge {
+	l.host, _ = os.Hostname()
+	l.pid = os.Getpid()
+	return l
+}
+
+// WithOutput sends l's standard output to stdout and its error output to
+// stderr. Several ledges may share the same writers. Call it before l is
+// shared.
+func (l *Ledge) WithOutput(stdout, stderr io.Writer) *Ledge {
+	l.stdout.SetOutput(stdout)
+	l.stderr.SetOutput(stderr)
+	return l
+}
+
+// WithStatsPrefix controls whether timing and stat lines carry l's prefix
+// like every other line, which is the default and tells apart ledges that
+// share a writer. Call it before l is shared.
+func (l *Ledge) WithStatsPrefix(include bool) *Ledge {
+	l.labelPrefix = include
+	return l
+}
+
+// WithRandSource makes every randomized sampling decision of l, such as
+// which PrintfSampled calls print, draw from src, so runs seeded alike sample
+// alike. Call it before l is shared.
+func (l *Ledge) WithRandSource(src rand.Source) *Ledge {
+	l.randLock.Lock()
+	defer l.randLock.Unlock()
+	l.rand = rand.New(src)
+	l.randSeed = 0
+	return l
+}
+
+// WithRandSeed is WithRandSource with rand.NewSource(seed), and additionally
+// reports seed in Config so a run can be reproduced.
+func (l *Ledge) WithRandSeed(seed int64) *Ledge {
+	l.WithRandSource(rand.NewSource(seed))
+	l.randSeed = seed
+	return l
+}
+
+// WithoutLocking drops the lock around records for callers that guarantee all
+// recording and reporting happens on a single goroutine. Using l concurrently
+// afterwards is a data race; run with -race if in doubt. Call it before any
+// records are made.
+func (l *Ledge) WithoutLocking() *Ledge {
+	l.recordsLock = noLock{}
+	return l
+}
+
+// randIntn returns a random int in [0, n) from l's own source.
+func (l *Ledge) randIntn(n int) int {
+	l.randLock.Lock()
+	defer l.randLock.Unlock()
+	return l.rand.Intn(n)
+}
+
 func (l *Ledge) DebugOff() {
 	l.debug.UnSet()
 }
@@ -45,6 +230,8 @@ func (l *Ledge) DebugOn() {
 	l.debug.Set()
 }
 
+// StatsOff stops timing functions from recording or printing. Samples that
+// were already recorded are kept and can still be reported.
 func (l *Ledge) StatsOff() {
 	l.stats.UnSet()
 }
@@ -53,53 +240,361 @@ func (l *Ledge) StatsOn() {
 	l.stats.Set()
 }
 
+// ReportingOff silences the stat printing methods (Stats, Count, Mean and the
+// like). Reporting is on by default and, unlike recording, independent of
+// StatsOn/StatsOff, so accumulated samples can be printed after stats are
+// turned off.
+func (l *Ledge) ReportingOff() {
+	l.reporting.UnSet()
+}
+
+func (l *Ledge) ReportingOn() {
+	l.reporting.Set()
+}
+
+// JSONOn switches output to one JSON object per line, e.g.
+// {"time":...,"level":"info","prefix":"juicebox A","msg":"..."}.
+func (l *Ledge) JSONOn() {
+	l.json.Set()
+}
+
+func (l *Ledge) JSONOff() {
+	l.json.UnSet()
+}
+
+func (l *Ledge) ColorOff() {
+	l.color.UnSet()
+}
+
+func (l *Ledge) ColorOn() {
+	l.color.Set()
+}
+
+// colorize renders v with its color, or as plain text when color is off or
+// output is JSON.
+func (l *Ledge) colorize(v Value) string {
+	if !l.color.IsSet() || l.json.IsSet() {
+		return fmt.Sprint(v.Value())
+	}
+	return v.String()
+}
+
+// emit writes a line to logger, or to the WithLevelWriter writer of level if
+// one is set. label is an optional colored tag such as [MEAN tag] that
+// precedes msg.
+func (l *Ledge) emit(logger *log.Logger, level Level, label Value, msg string) {
+	if w, ok := l.levelWriters[level]; ok {
+		l.writeTo(w, logger == l.stderr, level, label, msg)
+		return
+	}
+	l.write(logger, level, label, msg)
+}
+
+// write is emit without routing by WithLevelWriter, for lines that must reach
+// logger whatever their level.
+func (l *Ledge) write(logger *log.Logger, level Level, label Value, msg string) {
+	l.writeTo(logger, logger == l.stderr, level, label, msg)
+}
+
+// writeTo is the single formatting path for every line ledge writes. isErr
+// selects the error coloring of the prefix.
+func (l *Ledge) writeTo(logger *log.Logger, isErr bool, level Level, label Value, msg string) {
+	msg = l.truncate(strings.TrimSuffix(msg, "\n"))
+	if l.json.IsSet() {
+		if label != nil {
+			msg = fmt.Sprintf("%v %s", label.Value(), msg)
+		}
+		record := jsonRecord{
+			Time:    l.now().Format(time.RFC3339Nano),
+			Level:   level.String(),
+			Service: l.service,
+			Host:    l.host,
+			PID:     l.pid,
+			Prefix:  l.name,
+			Msg:     msg,
+		}
+		b, _ := json.Marshal(record)
+		logger.Print(string(b))
+		return
+	}
+	prefix := ""
+	if label == nil || l.labelPrefix {
+		prefix = l.colorize(Green(l.prefix))
+		if isErr {
+			prefix = l.colorize(BrightRed(l.prefix))
+		}
+	}
+	parts := make([]string, 0, 3)
+	if levelLabel, ok := levelLabels[level]; ok {
+		parts = append(parts, l.colorize(levelLabel))
+	}
+	if label != nil {
+		parts = append(parts, l.colorize(label))
+	}
+	logger.Print(l.now().Format(l.timeFormat) + " " + prefix + strings.Join(append(parts, msg), " "))
+}
+
+// truncatedSuffix marks a message cut short by WithMaxLineLength.
+const truncatedSuffix = "…(truncated)"
+
+// WithMaxLineLength cuts every formatted message longer than n bytes down to at
+// most n bytes, ending in "…(truncated)" if n leaves room for it, to protect
+// log pipelines from huge lines. Call it before l is shared.
+func (l *Ledge) WithMaxLineLength(n int) *Ledge {
+	l.maxLineLength = n
+	return l
+}
+
+func (l *Ledge) truncate(msg string) string {
+	if l.maxLineLength <= 0 || len(msg) <= l.maxLineLength {
+		return msg
+	}
+	suffix := truncatedSuffix
+	if l.maxLineLength < len(suffix) {
+		suffix = ""
+	}
+	n := l.maxLineLength - len(suffix)
+	for n > 0 && !utf8.RuneStart(msg[n]) {
+		n--
+	}
+	return msg[:n] + suffix
+}
+
 func (l *Ledge) Println(v ...interface{}) {
-	l.stdout.Println(v...)
+	if l == nil {
+		return
+	}
+	l.emit(l.stdout, LevelInfo, nil, fmt.Sprintln(v...))
 }
 
 func (l *Ledge) Printf(format string, v ...interface{}) {
-	l.stdout.Printf(format, v...)
+	if l == nil {
+		return
+	}
+	l.emit(l.stdout, LevelInfo, nil, fmt.Sprintf(format, v...))
+}
+
+// PrintfSampled is Printf for hot paths: each call prints with probability
+// 1/n, decided by l's random source, so roughly one in n calls is printed.
+// It reports whether this call printed.
+func (l *Ledge) PrintfSampled(n int, format string, v ...interface{}) bool {
+	if l == nil {
+		return false
+	}
+	if n > 1 && l.randIntn(n) != 0 {
+		return false
+	}
+	l.emit(l.stdout, LevelInfo, nil, fmt.Sprintf(format, v...))
+	return true
+}
+
+// Write makes l an io.Writer. Each call writes p as one line to standard
+// output, with a single timestamp and prefix; a trailing newline is dropped
+// and embedded newlines are kept. Nothing is buffered between calls, so
+// callers should write whole lines.
+func (l *Ledge) Write(p []byte) (int, error) {
+	if l == nil {
+		return len(p), nil
+	}
+	l.emit(l.stdout, LevelInfo, nil, string(p))
+	return len(p), nil
+}
+
+// errorWriter writes each line it is given as an error line of a Ledge.
+type errorWriter struct {
+	l *Ledge
+}
+
+func (w errorWriter) Write(p []byte) (int, error) {
+	w.l.emit(w.l.stderr, LevelError, nil, string(p))
+	return len(p), nil
+}
+
+// StdLogger returns a *log.Logger whose lines are written as l's error lines,
+// for components such as http.Server.ErrorLog that want a standard logger.
+func (l *Ledge) StdLogger() *log.Logger {
+	if l == nil {
+		return log.New(ioutil.Discard, "", 0)
+	}
+	return log.New(errorWriter{l}, "", 0)
 }
 
 func (l *Ledge) Debugf(format string, v ...interface{}) {
+	if l == nil {
+		return
+	}
 	if l.debug.IsSet() {
-		formatString := fmt.Sprintf("%s %s", Cyan("[DEBUG]"), format)
-		l.stderr.Printf(formatString, v...)
+		l.emit(l.stderr, LevelDebug, nil, fmt.Sprintf(format, v...))
 	}
 }
 
 func (l *Ledge) Debugln(v ...interface{}) {
+	if l == nil {
+		return
+	}
 	if l.debug.IsSet() {
-		l.stderr.Println(append([]interface{}{Cyan("[DEBUG]")}, v...)...)
+		l.emit(l.stderr, LevelDebug, nil, fmt.Sprintln(v...))
 	}
 }
 
+func (l *Ledge) Errorf(format string, v ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.emit(l.stderr, LevelError, nil, fmt.Sprintf(format, v...))
+}
+
+func (l *Ledge) Errorln(v ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.emit(l.stderr, LevelError, nil, fmt.Sprintln(v...))
+}
+
 func (l *Ledge) Panicf(format string, v ...interface{}) {
-	formatString := fmt.Sprintf("%s %s", Red("[PANIC]"), format)
-	l.stderr.Panicf(formatString, v...)
+	panic(l.logPanic(fmt.Sprintf(format, v...)))
 }
 
 func (l *Ledge) Panicln(v ...interface{}) {
-	l.stderr.Panicln(append([]interface{}{Red("[PANIC]")}, v...)...)
+	panic(l.logPanic(fmt.Sprintln(v...)))
+}
+
+// logPanic writes msg as a panic line, dumps stats if configured and flushes
+// any buffered output, so none of it is lost if the panic is not recovered.
+// It returns the value to panic with.
+func (l *Ledge) logPanic(msg string) string {
+	if l == nil {
+		return "[PANIC] " + msg
+	}
+	l.emit(l.stderr, LevelPanic, nil, msg)
+	l.dumpStats()
+	l.Flush()
+	return l.panicMessage(msg)
+}
+
+func (l *Ledge) Fatalf(format string, v ...interface{}) {
+	l.fatal(fmt.Sprintf(format, v...))
+}
+
+func (l *Ledge) Fatalln(v ...interface{}) {
+	l.fatal(fmt.Sprintln(v...))
+}
+
+// fatal writes msg as a fatal line, dumps stats if configured, flushes any
+// buffered output and exits.
+func (l *Ledge) fatal(msg string) {
+	if l != nil {
+		l.emit(l.stderr, LevelFatal, nil, msg)
+		l.dumpStats()
+		l.Flush()
+	}
+	os.Exit(1)
+}
+
+// WithStatsOnPanic makes Panicf, Panicln, Fatalf and Fatalln write a summary
+// of every tag to stderr before panicking or exiting, so recorded stats are
+// not lost. Call it before l is shared.
+func (l *Ledge) WithStatsOnPanic() *Ledge {
+	l.statsOnPanic = true
+	return l
+}
+
+// dumpStats writes a summary line per tag to stderr, whatever the level
+// writers, if WithStatsOnPanic was used. A panic while doing so is swallowed
+// so it cannot mask the original failure.
+func (l *Ledge) dumpStats() {
+	if !l.statsOnPanic {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	for _, tag := range l.tags() {
+		if s, ok := l.summary(tag); ok {
+			l.write(l.stderr, LevelInfo, nil, formatSummary(tag, s))
+		}
+	}
+}
+
+// panicMessage formats msg as the "[PANIC] msg" value Panicf and Panicln
+// panic with.
+func (l *Ledge) panicMessage(msg string) string {
+	return fmt.Sprintf("%s %s", l.colorize(levelLabels[LevelPanic]), msg)
 }
 
 func (l *Ledge) Check(err error) {
 	if err != nil {
-		l.Panicf("%v", err)
+		l.Panicf("%v%s", err, l.checkStack(err))
 	}
 }
 
 func (l *Ledge) CheckPrintf(err error, format string, v ...interface{}) {
 	if err != nil {
-		l.Panicf(format, v...)
+		l.Panicf("%s%s", fmt.Sprintf(format, v...), l.checkStack(err))
 	}
 }
 
 func (l *Ledge) CheckPrintln(err error, v ...interface{}) {
 	if err != nil {
 		v = append(v, err)
-		l.Panicln(v)
+		panic(l.logPanic(fmt.Sprintln(v...) + l.checkStack(err)))
+	}
+}
+
+// WithCheckStackTrace makes Check, CheckPrintf and CheckPrintln include a
+// stack trace in their panic: the error's own, if it has a StackTrace method
+// as github.com/pkg/errors errors do, or else the current goroutine's. Call it
+// before l is shared.
+func (l *Ledge) WithCheckStackTrace() *Ledge {
+	l.checkStackTrace = true
+	return l
+}
+
+// checkStack returns the stack trace to append to a Check panic for err, on a
+// line of its own, or "" if stack traces are off.
+func (l *Ledge) checkStack(err error) string {
+	if l == nil || !l.checkStackTrace {
+		return ""
 	}
+	if m := reflect.ValueOf(err).MethodByName("StackTrace"); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return fmt.Sprintf("\n%+v", m.Call(nil)[0].Interface())
+	}
+	return "\n" + string(debug.Stack())
+}
+
+// concurrency tracks how many timers for a tag are running at once.
+type concurrency struct {
+	inFlight int64
+	peak     int64
+}
+
+func (c *concurrency) exit() {
+	atomic.AddInt64(&c.inFlight, -1)
+}
+
+func (l *Ledge) enter(tag string) *concurrency {
+	v, ok := l.concurrency.Load(tag)
+	if !ok {
+		v, _ = l.concurrency.LoadOrStore(tag, &concurrency{})
+	}
+	c := v.(*concurrency)
+	n := atomic.AddInt64(&c.inFlight, 1)
+	for {
+		peak := atomic.LoadInt64(&c.peak)
+		if n <= peak || atomic.CompareAndSwapInt64(&c.peak, peak, n) {
+			return c
+		}
+	}
+}
+
+// MaxConcurrency returns the largest number of simultaneously running timers
+// observed for tag.
+func (l *Ledge) MaxConcurrency(tag string) int {
+	v, ok := l.concurrency.Load(tag)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt64(&v.(*concurrency).peak))
 }
 
 func toMillis(d time.Duration) float64 {
@@ -107,93 +602,398 @@ func toMillis(d time.Duration) float64 {
 }
 
 func (l *Ledge) Time(tag string, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	defer l.enter(tag).exit()
 	t0 := time.Now()
 	f()
 	if l.stats.IsSet() {
 		elapsed := time.Since(t0)
 		tagString := fmt.Sprintf("[TIME %s]", tag)
-		l.stdout.Printf("%s %s", Yellow(tagString), elapsed)
+		l.emit(l.stdout, LevelInfo, Yellow(tagString), elapsed.String())
 	}
 }
 
 func (l *Ledge) TimeAbove(tag string, above time.Duration, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	defer l.enter(tag).exit()
 	t0 := time.Now()
 	f()
 	if l.stats.IsSet() {
 		elapsed := time.Since(t0)
 		if elapsed > above {
 			tagString := fmt.Sprintf("[TIME-ABOVE %s]", tag)
-			s := fmt.Sprintf("%s %s", Yellow(tagString), elapsed)
-			l.stdout.Println(s)
+			l.emit(l.stdout, LevelInfo, Yellow(tagString), elapsed.String())
 		}
 	}
 }
 
-func (l *Ledge) Record(tag string, f func()) {
+// TimeAbovePercentile times f and records it into tag, printing the duration
+// only if it exceeds the given percentile of tag's earlier samples. Nothing
+// is printed until tag has at least the WithMinSamples count (and at least
+// one) of earlier samples.
+func (l *Ledge) TimeAbovePercentile(tag string, percentile float64, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	defer l.enter(tag).exit()
 	t0 := time.Now()
 	f()
 	if l.stats.IsSet() {
 		elapsed := time.Since(t0)
-		l.recordsLock.Lock()
-		defer l.recordsLock.Unlock()
-		if records, ok := l.records[tag]; ok {
-			l.records[tag] = append(records, toMillis(elapsed))
-		} else {
-			l.records[tag] = []float64{toMillis(elapsed)}
+		records := l.samples(l.normalize(tag))
+		l.recordElapsed(tag, elapsed)
+		if len(records) == 0 || len(records) < l.minSamples {
+			return
+		}
+		above, err := stats.PercentileNearestRank(records, percentile)
+		if err != nil {
+			l.Errorf("invalid percentile %v (must be in (0,100])", percentile)
+			return
+		}
+		if toMillis(elapsed) > above {
+			tagString := fmt.Sprintf("[TIME-ABOVE-P%s %s]", strconv.FormatFloat(percentile, 'f', -1, 64), tag)
+			l.emit(l.stdout, LevelInfo, Yellow(tagString), elapsed.String())
 		}
 	}
 }
 
+func (l *Ledge) Record(tag string, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	defer l.enter(tag).exit()
+	t0 := time.Now()
+	f()
+	if l.stats.IsSet() {
+		l.recordElapsed(tag, time.Since(t0))
+	}
+}
+
 func (l *Ledge) RecordAndPrint(tag string, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	defer l.enter(tag).exit()
 	t0 := time.Now()
 	f()
 	if l.stats.IsSet() {
 		elapsed := time.Since(t0)
-		l.recordsLock.Lock()
-		defer l.recordsLock.Unlock()
 		tagString := fmt.Sprintf("[RECORD %s]", tag)
-		s := fmt.Sprintf("%s %s", Yellow(tagString), elapsed)
-		l.stdout.Println(s)
-		if records, ok := l.records[tag]; ok {
-			l.records[tag] = append(records, toMillis(elapsed))
-		} else {
-			l.records[tag] = []float64{toMillis(elapsed)}
+		l.emit(l.stdout, LevelInfo, Yellow(tagString), elapsed.String())
+		l.recordElapsed(tag, elapsed)
+	}
+}
+
+// RecordIf times f and records the duration only if f returns true.
+func (l *Ledge) RecordIf(tag string, f func() bool) bool {
+	if l == nil {
+		return f()
+	}
+	defer l.enter(tag).exit()
+	t0 := time.Now()
+	ok := f()
+	if ok && l.stats.IsSet() {
+		l.recordElapsed(tag, time.Since(t0))
+	}
+	return ok
+}
+
+// RecordOnSuccess times f and records the duration only if f returns nil.
+func (l *Ledge) RecordOnSuccess(tag string, f func() error) error {
+	if l == nil {
+		return f()
+	}
+	defer l.enter(tag).exit()
+	t0 := time.Now()
+	err := f()
+	if err == nil && l.stats.IsSet() {
+		l.recordElapsed(tag, time.Since(t0))
+	}
+	return err
+}
+
+func (l *Ledge) RecordDuration(tag string, d time.Duration) {
+	if l == nil {
+		return
+	}
+	if l.stats.IsSet() {
+		l.recordElapsed(tag, d)
+	}
+}
+
+// RecordValue records v into tag as-is rather than as a duration.
+func (l *Ledge) RecordValue(tag string, v float64) {
+	if l == nil {
+		return
+	}
+	if l.stats.IsSet() {
+		l.record(tag, kindValue, v)
+	}
+}
+
+// RecordResultValue runs f, records its result into tag, and returns it.
+func (l *Ledge) RecordResultValue(tag string, f func() float64) float64 {
+	v := f()
+	l.RecordValue(tag, v)
+	return v
+}
+
+// RecordBatch appends values (in milliseconds) to tag under a single lock
+// acquisition, which is much cheaper than recording them one by one.
+func (l *Ledge) RecordBatch(tag string, values []float64) {
+	if l == nil {
+		return
+	}
+	if l.stats.IsSet() {
+		l.record(tag, kindDuration, values...)
+	}
+}
+
+func (l *Ledge) RecordDurations(tag string, ds []time.Duration) {
+	if l == nil {
+		return
+	}
+	if l.stats.IsSet() {
+		l.recordElapsed(tag, ds...)
+	}
+}
+
+// recordElapsed records durations into tag in milliseconds.
+func (l *Ledge) recordElapsed(tag string, ds ...time.Duration) bool {
+	values := make([]float64, 0, len(ds))
+	for _, d := range ds {
+		if l.maxPlausible > 0 && d > l.maxPlausible {
+			l.Debugf("implausible duration %s recorded into %s (limit %s)", d, tag, l.maxPlausible)
+			if l.dropImplausible {
+				continue
+			}
 		}
+		values = append(values, toMillis(d))
 	}
+	if len(values) == 0 && len(ds) > 0 {
+		return false
+	}
+	return l.record(tag, kindDuration, values...)
+}
+
+// WithMaxPlausible logs a debug warning for every recorded duration longer
+// than max, which usually means a clock bug or a stuck or forgotten timer,
+// and drops such durations if drop is set. Call it before l is shared.
+func (l *Ledge) WithMaxPlausible(max time.Duration, drop bool) *Ledge {
+	l.maxPlausible = max
+	l.dropImplausible = drop
+	return l
+}
+
+// record appends values of kind k to tag's records, returning false if they
+// were rejected because tag holds another kind of sample.
+func (l *Ledge) record(tag string, k kind, values ...float64) bool {
+	tag = l.normalize(tag)
+	l.recordsLock.Lock()
+	if existing, ok := l.kinds[tag]; ok && existing != k {
+		l.recordsLock.Unlock()
+		l.kindMismatch(tag, existing, k)
+		return false
+	}
+	l.kinds[tag] = k
+	if k == kindDuration {
+		instant := toMillis(l.instantThreshold)
+		for _, v := range values {
+			if v < instant {
+				l.instants[tag]++
+			}
+		}
+	}
+	l.records[tag] = append(l.records[tag], values...)
+	delete(l.sorted, tag)
+	if sketch, ok := l.sketches[tag]; ok {
+		for _, v := range values {
+			sketch.Add(v)
+		}
+	}
+	autoSummarize := false
+	if l.autoSummary > 0 {
+		before := l.autoCounts[tag]
+		l.autoCounts[tag] += len(values)
+		autoSummarize = before/l.autoSummary != l.autoCounts[tag]/l.autoSummary
+	}
+	if l.rollupInterval > 0 {
+		now := l.clock.Now()
+		for range values {
+			l.stamps[tag] = append(l.stamps[tag], now)
+		}
+		l.rollup(tag, now)
+	}
+	evicted := l.account(tag, len(values))
+	l.recordsLock.Unlock()
+	l.sampled(tag, values)
+	for _, t := range evicted {
+		l.Debugf("evicted records of %s to stay within the memory budget", t)
+	}
+	if autoSummarize {
+		l.StatsLine(tag)
+	}
+	return true
 }
 
 func (l *Ledge) ClearRecords(tag string) {
 	l.recordsLock.Lock()
 	defer l.recordsLock.Unlock()
+	l.unaccount(tag)
 	l.records[tag] = make([]float64, 0)
+	delete(l.sorted, tag)
+	delete(l.slo, tag)
+	delete(l.sources, tag)
+	delete(l.instants, tag)
+	delete(l.stamps, tag)
+	delete(l.rollups, tag)
+	delete(l.deltaCursors, tag)
+	if sketch, ok := l.sketches[tag]; ok {
+		l.sketches[tag] = NewSketch(sketch.accuracy)
+	}
+}
+
+// samples returns a copy of tag's records taken under the read lock. Stats
+// are only ever computed over such copies, so records may be modified in
+// place while holding the write lock.
+func (l *Ledge) samples(tag string) []float64 {
+	l.recordsLock.RLock()
+	defer l.recordsLock.RUnlock()
+	return append([]float64(nil), l.records[tag]...)
+}
+
+func (l *Ledge) count(tag string) int {
+	l.recordsLock.RLock()
+	defer l.recordsLock.RUnlock()
+	return len(l.records[tag])
+}
+
+// CountAbove returns how many of tag's samples exceed threshold, or false if
+// tag has no samples.
+func (l *Ledge) CountAbove(tag string, threshold float64) (int, bool) {
+	records := l.samples(tag)
+	if len(records) == 0 {
+		return 0, false
+	}
+	return countAbove(records, threshold), true
+}
+
+// FractionAbove returns the fraction of tag's samples that exceed threshold,
+// or false if tag has no samples.
+func (l *Ledge) FractionAbove(tag string, threshold float64) (float64, bool) {
+	records := l.samples(tag)
+	if len(records) == 0 {
+		return 0, false
+	}
+	return float64(countAbove(records, threshold)) / float64(len(records)), true
+}
+
+// MaxAbs returns the sample of tag furthest from zero, as an absolute value,
+// which is the worst deviation for signed values such as scheduling jitter
+// recorded with RecordValue. It returns false if tag has no samples.
+func (l *Ledge) MaxAbs(tag string) (float64, bool) {
+	records := l.samples(tag)
+	if len(records) == 0 {
+		return 0, false
+	}
+	max := 0.0
+	for _, r := range records {
+		max = math.Max(max, math.Abs(r))
+	}
+	return max, true
 }
 
+func countAbove(records []float64, threshold float64) int {
+	n := 0
+	for _, r := range records {
+		if r > threshold {
+			n++
+		}
+	}
+	return n
+}
+
+// WithMinSamples makes Median, Perc and Variance print an "insufficient
+// samples" notice instead of a value for tags with fewer than n samples.
+// Count, Min, Max and Mean are unaffected. Call it before l is shared.
+func (l *Ledge) WithMinSamples(n int) *Ledge {
+	l.minSamples = n
+	return l
+}
+
+// WithStatsMarker prepends marker to every stat line, so that e.g.
+// grep LEDGE-STAT finds all of them. Call it before l is shared.
+func (l *Ledge) WithStatsMarker(marker string) *Ledge {
+	l.statsMarker = marker
+	return l
+}
+
+// emitStat writes a stat line labelled tagString.
+func (l *Ledge) emitStat(tagString, msg string) {
+	if l.statsMarker != "" {
+		tagString = l.statsMarker + " " + tagString
+	}
+	l.emit(l.stdout, LevelInfo, Magenta(tagString), msg)
+}
+
+// insufficient prints a notice under tagString and returns true if count is
+// below the configured minimum sample count.
+func (l *Ledge) insufficient(tagString string, count int) bool {
+	if count >= l.minSamples {
+		return false
+	}
+	l.emitStat(tagString, fmt.Sprintf("(insufficient samples: %d < %d)", count, l.minSamples))
+	return true
+}
+
+// Stats prints the count, min, median, p99, max, mean and variance of tag (or
+// the metrics set with WithStatsOrder), or a single "no samples" line if tag
+// has none. All metrics come from one Summary snapshot, so the lines agree
+// with each other even while samples are being recorded.
 func (l *Ledge) Stats(tag string) {
-	l.Count(tag)
-	l.Min(tag)
-	l.Median(tag)
-	l.Perc(tag, 99)
-	l.Max(tag)
-	l.Mean(tag)
-	l.Variance(tag)
+	if l == nil {
+		return
+	}
+	if !l.reporting.IsSet() {
+		return
+	}
+	s, ok := l.summary(tag)
+	if !ok {
+		l.emitStat(fmt.Sprintf("[STATS %s]", tag), "no samples")
+		return
+	}
+	for _, m := range l.statsOrder {
+		l.printMetric(tag, s, m)
+	}
+	l.statsReported(tag, s)
 }
 
 func (l *Ledge) Count(tag string) {
-	if l.stats.IsSet() {
-		l.recordsLock.RLock()
-		records := l.records[tag]
-		l.recordsLock.RUnlock()
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
 		tagString := fmt.Sprintf("[COUNT %s]", tag)
-		l.stdout.Printf("%s %d", Magenta(tagString), len(records))
+		l.emitStat(tagString, fmt.Sprintf("%d", l.count(tag)))
 	}
 }
 
 func (l *Ledge) Mean(tag string) {
-	if l.stats.IsSet() {
-		l.recordsLock.RLock()
-		records, ok := l.records[tag]
-		l.recordsLock.RUnlock()
-		if !ok || len(records) == 0 {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		records := l.samples(tag)
+		if len(records) == 0 {
 			return
 		}
 		r, e := stats.Mean(records)
@@ -201,50 +1001,55 @@ func (l *Ledge) Mean(tag string) {
 			panic(e)
 		}
 		tagString := fmt.Sprintf("[MEAN %s]", tag)
-		l.stdout.Printf("%s %f", Magenta(tagString), r)
+		l.emitStat(tagString, fmt.Sprintf("%f", r))
 	}
 }
 
 func (l *Ledge) Median(tag string) {
-	if l.stats.IsSet() {
-		l.recordsLock.RLock()
-		records, ok := l.records[tag]
-		l.recordsLock.RUnlock()
-		if !ok || len(records) == 0 {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		records := l.sortedSamples(tag)
+		if len(records) == 0 {
 			return
 		}
-		r, e := stats.Median(records)
-		if e != nil {
-			panic(e)
-		}
 		tagString := fmt.Sprintf("[MEDIAN %s]", tag)
-		l.stdout.Printf("%s %f", Magenta(tagString), r)
+		if l.insufficient(tagString, len(records)) {
+			return
+		}
+		l.emitStat(tagString, fmt.Sprintf("%f", medianSorted(records)))
 	}
 }
 
 func (l *Ledge) Perc(tag string, perc float64) {
-	if l.stats.IsSet() {
-		l.recordsLock.RLock()
-		records, ok := l.records[tag]
-		l.recordsLock.RUnlock()
-		if !ok || len(records) == 0 {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		if !(perc > 0 && perc <= 100) {
+			l.Errorf("invalid percentile %v (must be in (0,100])", perc)
 			return
 		}
-		r, e := stats.PercentileNearestRank(records, perc)
-		if e != nil {
-			panic(e)
+		records := l.sortedSamples(tag)
+		if len(records) == 0 {
+			return
+		}
+		tagString := fmt.Sprintf("[PERC-%s %s]", strconv.FormatFloat(perc, 'f', -1, 64), tag)
+		if l.insufficient(tagString, len(records)) {
+			return
 		}
-		tagString := fmt.Sprintf("[PERC-%d %s]", uint(perc), tag)
-		l.stdout.Printf("%s %f", Magenta(tagString), r)
+		l.emitStat(tagString, fmt.Sprintf("%f", percentileSorted(records, perc)))
 	}
 }
 
 func (l *Ledge) Min(tag string) {
-	if l.stats.IsSet() {
-		l.recordsLock.RLock()
-		records, ok := l.records[tag]
-		l.recordsLock.RUnlock()
-		if !ok || len(records) == 0 {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		records := l.samples(tag)
+		if len(records) == 0 {
 			return
 		}
 		r, e := stats.Min(records)
@@ -252,16 +1057,17 @@ func (l *Ledge) Min(tag string) {
 			panic(e)
 		}
 		tagString := fmt.Sprintf("[MIN %s]", tag)
-		l.stdout.Printf("%s %f", Magenta(tagString), r)
+		l.emitStat(tagString, fmt.Sprintf("%f", r))
 	}
 }
 
 func (l *Ledge) Max(tag string) {
-	if l.stats.IsSet() {
-		l.recordsLock.RLock()
-		records, ok := l.records[tag]
-		l.recordsLock.RUnlock()
-		if !ok || len(records) == 0 {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		records := l.samples(tag)
+		if len(records) == 0 {
 			return
 		}
 		r, e := stats.Max(records)
@@ -269,23 +1075,27 @@ func (l *Ledge) Max(tag string) {
 			panic(e)
 		}
 		tagString := fmt.Sprintf("[MAX %s]", tag)
-		l.stdout.Printf("%s %f", Magenta(tagString), r)
+		l.emitStat(tagString, fmt.Sprintf("%f", r))
 	}
 }
 
 func (l *Ledge) Variance(tag string) {
-	if l.stats.IsSet() {
-		l.recordsLock.RLock()
-		records, ok := l.records[tag]
-		l.recordsLock.RUnlock()
-		if !ok || len(records) == 0 {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		records := l.samples(tag)
+		if len(records) == 0 {
+			return
+		}
+		tagString := fmt.Sprintf("[VARIANCE %s]", tag)
+		if l.insufficient(tagString, len(records)) {
 			return
 		}
 		r, e := stats.Variance(records)
 		if e != nil {
 			panic(e)
 		}
-		tagString := fmt.Sprintf("[VARIANCE %s]", tag)
-		l.stdout.Printf("%s %f", Magenta(tagString), r)
+		l.emitStat(tagString, fmt.Sprintf("%f", r))
 	}
 }
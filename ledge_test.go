@@ -0,0 +1,1167 @@
+package ledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// newTestLedge returns a recording Ledge with color off whose standard and
+// error output are captured.
+func newTestLedge() (l *Ledge, stdout, stderr *bytes.Buffer) {
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	l = New("test").WithOutput(stdout, stderr)
+	l.ColorOff()
+	l.StatsOn()
+	return l, stdout, stderr
+}
+
+// lines splits captured output into its non-empty lines.
+func lines(b *bytes.Buffer) []string {
+	var out []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// fakeClock is a Clock that only moves when told to; its Sleep advances it.
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+func mustPanic(t *testing.T, f func()) (recovered interface{}) {
+	t.Helper()
+	defer func() {
+		recovered = recover()
+		if recovered == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestPanicfJSON(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.JSONOn()
+	r := mustPanic(t, func() { l.Panicf("bad %d", 42) })
+	if !strings.Contains(r.(string), "bad 42") {
+		t.Errorf("panic value %q does not carry the message", r)
+	}
+	var record jsonRecord
+	if err := json.Unmarshal(stderr.Bytes(), &record); err != nil {
+		t.Fatalf("panic line %q is not JSON: %v", stderr.String(), err)
+	}
+	if record.Level != "panic" || record.Msg != "bad 42" {
+		t.Errorf("got %+v, want level panic and msg %q", record, "bad 42")
+	}
+}
+
+func TestPaniclnJSON(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.JSONOn()
+	mustPanic(t, func() { l.Panicln("bad", "news") })
+	var record jsonRecord
+	if err := json.Unmarshal(stderr.Bytes(), &record); err != nil {
+		t.Fatalf("panic line %q is not JSON: %v", stderr.String(), err)
+	}
+	if record.Level != "panic" || record.Msg != "bad news" {
+		t.Errorf("got %+v", record)
+	}
+}
+
+func TestJSONConcurrentWrites(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.JSONOn()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				l.Printf("worker %d line %d", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	got := lines(stdout)
+	if len(got) != 8*50 {
+		t.Fatalf("got %d lines, want %d", len(got), 8*50)
+	}
+	for _, line := range got {
+		var record jsonRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	l, _, _ := newTestLedge()
+	const n = 10
+	var entered, done sync.WaitGroup
+	entered.Add(n)
+	release := make(chan struct{})
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			l.Record("overlap", func() {
+				entered.Done()
+				<-release
+			})
+		}()
+	}
+	entered.Wait()
+	close(release)
+	done.Wait()
+	if got := l.MaxConcurrency("overlap"); got < n {
+		t.Errorf("MaxConcurrency = %d, want at least %d", got, n)
+	}
+	l.Record("serial", func() {})
+	l.Record("serial", func() {})
+	if got := l.MaxConcurrency("serial"); got != 1 {
+		t.Errorf("MaxConcurrency of serial timers = %d, want 1", got)
+	}
+	if got := l.MaxConcurrency("never"); got != 0 {
+		t.Errorf("MaxConcurrency of unused tag = %d, want 0", got)
+	}
+}
+
+func TestRandSeedSampling(t *testing.T) {
+	decisions := func(seed int64) []bool {
+		l, _, _ := newTestLedge()
+		l.WithRandSource(rand.NewSource(seed))
+		var d []bool
+		for i := 0; i < 200; i++ {
+			d = append(d, l.PrintfSampled(4, "line %d", i))
+		}
+		return d
+	}
+	a, b := decisions(7), decisions(7)
+	printed := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("decision %d differs between ledges with the same seed", i)
+		}
+		if a[i] {
+			printed++
+		}
+	}
+	if printed == 0 || printed == len(a) {
+		t.Errorf("printed %d of %d lines, want roughly a quarter", printed, len(a))
+	}
+	if c := decisions(8); equalBools(a, c) {
+		t.Error("different seeds made identical decisions")
+	}
+}
+
+func equalBools(a, b []bool) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func TestPrintfSampledOutput(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithRandSeed(1)
+	want := 0
+	for i := 0; i < 100; i++ {
+		if l.PrintfSampled(3, "x") {
+			want++
+		}
+	}
+	if got := len(lines(stdout)); got != want {
+		t.Errorf("wrote %d lines but reported %d printed", got, want)
+	}
+	if !l.PrintfSampled(1, "always") {
+		t.Error("PrintfSampled(1, ...) did not print")
+	}
+}
+
+func TestRandSeedConfig(t *testing.T) {
+	l, _, _ := newTestLedge()
+	if l.Config().RandSeed == 0 {
+		t.Error("default seed not reported")
+	}
+	if got := l.WithRandSeed(42).Config().RandSeed; got != 42 {
+		t.Errorf("RandSeed = %d, want 42", got)
+	}
+	if got := l.WithRandSource(rand.NewSource(1)).Config().RandSeed; got != 0 {
+		t.Errorf("RandSeed = %d for a source of unknown seed, want 0", got)
+	}
+}
+
+func TestRecordBatchMatchesElementwise(t *testing.T) {
+	ds := []time.Duration{3 * time.Millisecond, time.Millisecond, 7 * time.Millisecond, 2 * time.Millisecond}
+	batch, _, _ := newTestLedge()
+	batch.RecordDurations("d", ds)
+	single, _, _ := newTestLedge()
+	for _, d := range ds {
+		single.RecordDuration("d", d)
+	}
+	b, _ := batch.Summary("d")
+	s, _ := single.Summary("d")
+	if b != s || b.Count != len(ds) {
+		t.Errorf("batch summary %+v, element-wise %+v", b, s)
+	}
+
+	values := []float64{5, 1, 4}
+	batch.RecordBatch("v", values)
+	for _, v := range values {
+		single.RecordBatch("v", []float64{v})
+	}
+	if got, want := batch.samples("v"), single.samples("v"); !equalFloats(got, want) {
+		t.Errorf("batch samples %v, element-wise %v", got, want)
+	}
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func benchDurations(n int) []time.Duration {
+	ds := make([]time.Duration, n)
+	for i := range ds {
+		ds[i] = time.Duration(i) * time.Microsecond
+	}
+	return ds
+}
+
+func BenchmarkRecordDurations(b *testing.B) {
+	ds := benchDurations(1000)
+	l, _, _ := newTestLedge()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.RecordDurations("bench", ds)
+		l.ClearRecords("bench")
+	}
+}
+
+func BenchmarkRecordDurationElementwise(b *testing.B) {
+	ds := benchDurations(1000)
+	l, _, _ := newTestLedge()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, d := range ds {
+			l.RecordDuration("bench", d)
+		}
+		l.ClearRecords("bench")
+	}
+}
+
+func TestPercInvalid(t *testing.T) {
+	for _, perc := range []float64{0, -1, 100.5, 150} {
+		l, stdout, stderr := newTestLedge()
+		l.RecordBatch("a", []float64{1, 2, 3})
+		l.Perc("a", perc)
+		if stdout.Len() != 0 {
+			t.Errorf("Perc(%v) printed %q", perc, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), "invalid percentile") || !strings.Contains(stderr.String(), "(must be in (0,100])") {
+			t.Errorf("Perc(%v) error output %q", perc, stderr.String())
+		}
+	}
+}
+
+func TestPercInvalidReportingOff(t *testing.T) {
+	l, stdout, stderr := newTestLedge()
+	l.RecordBatch("a", []float64{1})
+	l.ReportingOff()
+	l.Perc("a", 150)
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("wrote %q and %q with reporting off", stdout.String(), stderr.String())
+	}
+}
+
+func TestPercFractional(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	l.RecordBatch("a", values)
+	l.Perc("a", 99.9)
+	if got := stdout.String(); !strings.Contains(got, "[PERC-99.9 a] 999.000000") {
+		t.Errorf("Perc(99.9) printed %q", got)
+	}
+	stdout.Reset()
+	l.Perc("a", 100)
+	if got := stdout.String(); !strings.Contains(got, "[PERC-100 a] 1000.000000") {
+		t.Errorf("Perc(100) printed %q", got)
+	}
+}
+
+func TestCountAbove(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("lat", []float64{50, 120, 199, 200, 201, 350, 900, 10, 75, 400})
+	for _, tc := range []struct {
+		threshold float64
+		count     int
+		fraction  float64
+	}{
+		{0, 10, 1},
+		{100, 7, 0.7},
+		{200, 4, 0.4},
+		{400, 1, 0.1},
+		{1000, 0, 0},
+	} {
+		count, ok := l.CountAbove("lat", tc.threshold)
+		if !ok || count != tc.count {
+			t.Errorf("CountAbove(%v) = %d, %v, want %d", tc.threshold, count, ok, tc.count)
+		}
+		fraction, ok := l.FractionAbove("lat", tc.threshold)
+		if !ok || fraction != tc.fraction {
+			t.Errorf("FractionAbove(%v) = %v, %v, want %v", tc.threshold, fraction, ok, tc.fraction)
+		}
+	}
+	if _, ok := l.CountAbove("none", 1); ok {
+		t.Error("CountAbove of an empty tag reported ok")
+	}
+	if _, ok := l.FractionAbove("none", 1); ok {
+		t.Error("FractionAbove of an empty tag reported ok")
+	}
+}
+
+func TestWithoutLocking(t *testing.T) {
+	locked, lockedOut, _ := newTestLedge()
+	unlocked, unlockedOut, _ := newTestLedge()
+	unlocked.WithoutLocking()
+	for _, l := range []*Ledge{locked, unlocked} {
+		for i := 1; i <= 100; i++ {
+			l.RecordValue("v", float64(i))
+		}
+		l.Stats("v")
+	}
+	if !strings.Contains(unlockedOut.String(), "[COUNT v] 100") {
+		t.Errorf("unlocked Stats printed %q", unlockedOut.String())
+	}
+	strip := func(s string) []string {
+		var out []string
+		for _, line := range strings.Split(s, "\n") {
+			if i := strings.Index(line, "["); i >= 0 {
+				out = append(out, line[i:])
+			}
+		}
+		return out
+	}
+	if a, b := strip(lockedOut.String()), strip(unlockedOut.String()); strings.Join(a, "\n") != strings.Join(b, "\n") {
+		t.Errorf("locked and unlocked stats differ:\n%v\n%v", a, b)
+	}
+	if unlocked.Config().Locking {
+		t.Error("Config reports locking after WithoutLocking")
+	}
+}
+
+func BenchmarkRecordValueLocked(b *testing.B) {
+	l, _, _ := newTestLedge()
+	for i := 0; i < b.N; i++ {
+		l.RecordValue("bench", 1)
+	}
+}
+
+func BenchmarkRecordValueWithoutLocking(b *testing.B) {
+	l, _, _ := newTestLedge()
+	l.WithoutLocking()
+	for i := 0; i < b.N; i++ {
+		l.RecordValue("bench", 1)
+	}
+}
+
+func TestRecordIf(t *testing.T) {
+	l, _, _ := newTestLedge()
+	if l.RecordIf("op", func() bool { return false }) {
+		t.Error("RecordIf did not pass through false")
+	}
+	if l.count("op") != 0 {
+		t.Error("failed operation was recorded")
+	}
+	if !l.RecordIf("op", func() bool { return true }) {
+		t.Error("RecordIf did not pass through true")
+	}
+	if l.count("op") != 1 {
+		t.Errorf("count = %d after one success, want 1", l.count("op"))
+	}
+}
+
+func TestRecordOnSuccess(t *testing.T) {
+	l, _, _ := newTestLedge()
+	failure := errors.New("failed")
+	if err := l.RecordOnSuccess("op", func() error { return failure }); err != failure {
+		t.Errorf("RecordOnSuccess returned %v, want %v", err, failure)
+	}
+	if l.count("op") != 0 {
+		t.Error("failed operation was recorded")
+	}
+	if err := l.RecordOnSuccess("op", func() error { return nil }); err != nil {
+		t.Errorf("RecordOnSuccess returned %v", err)
+	}
+	if l.count("op") != 1 {
+		t.Errorf("count = %d after one success, want 1", l.count("op"))
+	}
+}
+
+func TestRecordResultValue(t *testing.T) {
+	l, _, _ := newTestLedge()
+	for _, v := range []float64{0.5, 2, 7} {
+		v := v
+		if got := l.RecordResultValue("score", func() float64 { return v }); got != v {
+			t.Errorf("RecordResultValue returned %v, want %v", got, v)
+		}
+	}
+	if got := l.samples("score"); !equalFloats(got, []float64{0.5, 2, 7}) {
+		t.Errorf("samples = %v", got)
+	}
+	l.StatsOff()
+	if got := l.RecordResultValue("score", func() float64 { return 9 }); got != 9 {
+		t.Errorf("RecordResultValue with stats off returned %v", got)
+	}
+	if l.count("score") != 3 {
+		t.Error("RecordResultValue recorded with stats off")
+	}
+}
+
+func TestMinSamplesInsufficient(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithMinSamples(5)
+	l.RecordBatch("a", []float64{1, 2, 3})
+	l.Median("a")
+	l.Perc("a", 99)
+	l.Variance("a")
+	l.Count("a")
+	l.Min("a")
+	l.Max("a")
+	l.Mean("a")
+	want := []string{
+		"[MEDIAN a] (insufficient samples: 3 < 5)",
+		"[PERC-99 a] (insufficient samples: 3 < 5)",
+		"[VARIANCE a] (insufficient samples: 3 < 5)",
+		"[COUNT a] 3",
+		"[MIN a] 1.000000",
+		"[MAX a] 3.000000",
+		"[MEAN a] 2.000000",
+	}
+	got := lines(stdout)
+	if len(got) != len(want) {
+		t.Fatalf("got %q", got)
+	}
+	for i := range want {
+		if !strings.HasSuffix(got[i], want[i]) {
+			t.Errorf("line %d = %q, want suffix %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMinSamplesSufficient(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithMinSamples(3)
+	l.RecordBatch("a", []float64{1, 2, 3})
+	l.Median("a")
+	l.Perc("a", 50)
+	l.Variance("a")
+	if strings.Contains(stdout.String(), "insufficient") {
+		t.Errorf("gated with enough samples: %q", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "[MEDIAN a] 2.000000") {
+		t.Errorf("output %q", stdout.String())
+	}
+}
+
+func TestStatsMarker(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithStatsMarker("LEDGE-STAT")
+	l.RecordBatch("a", []float64{1, 2, 3})
+	l.Printf("not a stat")
+	l.Count("a")
+	l.Mean("a")
+	l.Perc("a", 90)
+	l.Variance("a")
+	got := lines(stdout)
+	if strings.Contains(got[0], "LEDGE-STAT") {
+		t.Errorf("marker on a non-stat line: %q", got[0])
+	}
+	for _, want := range []string{"LEDGE-STAT [COUNT a]", "LEDGE-STAT [MEAN a]", "LEDGE-STAT [PERC-90 a]", "LEDGE-STAT [VARIANCE a]"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestStatsMarkerOffByDefault(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1})
+	l.Stats("a")
+	if strings.Contains(stdout.String(), "LEDGE-STAT") {
+		t.Errorf("marker without WithStatsMarker: %q", stdout.String())
+	}
+}
+
+func TestStatsAbsentTag(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.Stats("missing")
+	l.ClearRecords("cleared")
+	l.Stats("cleared")
+	got := lines(stdout)
+	if len(got) != 2 || !strings.HasSuffix(got[0], "[STATS missing] no samples") || !strings.HasSuffix(got[1], "[STATS cleared] no samples") {
+		t.Errorf("Stats of empty tags printed %q", got)
+	}
+}
+
+func TestStatsPopulatedTag(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1, 2, 3})
+	l.Stats("a")
+	got := lines(stdout)
+	if len(got) != 7 || !strings.HasSuffix(got[0], "[COUNT a] 3") {
+		t.Errorf("Stats printed %q", got)
+	}
+	if strings.Contains(stdout.String(), "no samples") {
+		t.Error("no samples line for a populated tag")
+	}
+}
+
+func TestPanicMessage(t *testing.T) {
+	l, _, _ := newTestLedge()
+	if got := l.panicMessage("it broke"); got != "[PANIC] it broke" {
+		t.Errorf("panicMessage = %q", got)
+	}
+	l.ColorOn()
+	if got := l.panicMessage("it broke"); got != "\x1b[31m[PANIC]\x1b[0m it broke" {
+		t.Errorf("colored panicMessage = %q", got)
+	}
+}
+
+func TestPanicfValue(t *testing.T) {
+	l, _, _ := newTestLedge()
+	if r := mustPanic(t, func() { l.Panicf("code %d", 7) }); r != "[PANIC] code 7" {
+		t.Errorf("Panicf panicked with %q", r)
+	}
+}
+
+func TestStatsPrefixSharedWriter(t *testing.T) {
+	var shared bytes.Buffer
+	a := New("svc", "a").WithOutput(&shared, &shared)
+	b := New("svc", "b").WithOutput(&shared, &shared)
+	for _, l := range []*Ledge{a, b} {
+		l.ColorOff()
+		l.StatsOn()
+		l.RecordBatch("t", []float64{1})
+		l.Time("t", func() {})
+		l.Stats("t")
+	}
+	got := lines(&shared)
+	if len(got) != 16 {
+		t.Fatalf("got %d lines: %q", len(got), got)
+	}
+	for i, line := range got {
+		want := "[svc a] ["
+		if i >= 8 {
+			want = "[svc b] ["
+		}
+		if !strings.Contains(line, want) {
+			t.Errorf("line %q lacks prefix %q", line, want)
+		}
+	}
+}
+
+func TestWithStatsPrefixOff(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithStatsPrefix(false)
+	l.RecordBatch("t", []float64{1})
+	l.Printf("plain")
+	l.Count("t")
+	got := lines(stdout)
+	if !strings.Contains(got[0], "[test] plain") {
+		t.Errorf("plain line %q lost its prefix", got[0])
+	}
+	if strings.Contains(got[1], "[test]") || !strings.Contains(got[1], "[COUNT t] 1") {
+		t.Errorf("stat line %q", got[1])
+	}
+}
+
+// TestConcurrentRecordClearStats is meant to be run with -race.
+func TestConcurrentRecordClearStats(t *testing.T) {
+	l, _, _ := newTestLedge()
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					f()
+				}
+			}
+		}()
+	}
+	run(func() { l.RecordValue("a", 1) })
+	run(func() { l.RecordBatch("a", []float64{2, 3}) })
+	run(func() { l.ClearRecords("a") })
+	run(func() { l.Stats("a") })
+	run(func() { l.Summary("a") })
+	run(func() { l.Perc("a", 90) })
+	run(func() { l.CountAbove("a", 1) })
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+func TestSamplesIsACopy(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1, 2})
+	s := l.samples("a")
+	s[0] = 100
+	if got := l.samples("a"); got[0] != 1 {
+		t.Errorf("modifying a copy changed the records: %v", got)
+	}
+}
+
+func TestWithServiceNameText(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithServiceName("billing")
+	l.Printf("hello")
+	if !strings.Contains(stdout.String(), "[billing] [test] hello") {
+		t.Errorf("text line %q lacks the service", stdout.String())
+	}
+}
+
+func TestWithServiceNameJSON(t *testing.T) {
+	l, stdout, stderr := newTestLedge()
+	l.WithServiceName("billing")
+	l.JSONOn()
+	l.Printf("hello")
+	l.Errorf("oops")
+	for _, line := range append(lines(stdout), lines(stderr)...) {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["service"] != "billing" || record["prefix"] != "test" {
+			t.Errorf("record %v, want service billing and prefix test", record)
+		}
+	}
+}
+
+func TestServiceOmittedByDefault(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.JSONOn()
+	l.Printf("hello")
+	if strings.Contains(stdout.String(), `"service"`) {
+		t.Errorf("service field without WithServiceName: %q", stdout.String())
+	}
+}
+
+func TestTimeAbovePercentile(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithMinSamples(10)
+	baseline := make([]time.Duration, 20)
+	for i := range baseline {
+		baseline[i] = time.Microsecond
+	}
+	l.RecordDurations("op", baseline)
+	l.TimeAbovePercentile("op", 95, func() { time.Sleep(5 * time.Millisecond) })
+	if !strings.Contains(stdout.String(), "[TIME-ABOVE-P95 op]") {
+		t.Errorf("slow call not reported: %q", stdout.String())
+	}
+	if l.count("op") != 21 {
+		t.Errorf("count = %d, want the slow call recorded", l.count("op"))
+	}
+}
+
+func TestTimeAbovePercentileNormalized(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithTagNormalizer(strings.ToLower)
+	baseline := make([]time.Duration, 20)
+	for i := range baseline {
+		baseline[i] = time.Microsecond
+	}
+	l.RecordDurations("op", baseline)
+	l.TimeAbovePercentile("Op", 95, func() { time.Sleep(3 * time.Millisecond) })
+	if !strings.Contains(stdout.String(), "[TIME-ABOVE-P95 Op]") {
+		t.Errorf("slow call not compared with the normalized tag's history: %q", stdout.String())
+	}
+	if l.count("op") != 21 {
+		t.Errorf("count = %d, want the slow call recorded into op", l.count("op"))
+	}
+}
+
+func TestTimeAbovePercentileFast(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordDurations("op", []time.Duration{time.Hour, time.Hour})
+	l.TimeAbovePercentile("op", 50, func() {})
+	if stdout.Len() != 0 {
+		t.Errorf("fast call reported: %q", stdout.String())
+	}
+}
+
+func TestTimeAbovePercentileNeedsHistory(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithMinSamples(5)
+	l.RecordDurations("op", []time.Duration{time.Nanosecond})
+	l.TimeAbovePercentile("op", 50, func() { time.Sleep(time.Millisecond) })
+	l.TimeAbovePercentile("fresh", 50, func() { time.Sleep(time.Millisecond) })
+	if stdout.Len() != 0 {
+		t.Errorf("reported without enough history: %q", stdout.String())
+	}
+}
+
+func TestWriteFprintf(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	fmt.Fprintf(l, "answer=%d", 42)
+	fmt.Fprintf(l, "first\nsecond\n")
+	got := lines(stdout)
+	if len(got) != 3 {
+		t.Fatalf("got %q", got)
+	}
+	if !strings.HasSuffix(got[0], " [test] answer=42") {
+		t.Errorf("line %q", got[0])
+	}
+	if !strings.HasSuffix(got[1], " [test] first") || got[2] != "second" {
+		t.Errorf("multi-line write gave %q, want one prefix for the write", got[1:])
+	}
+}
+
+func TestWriteReturnsLength(t *testing.T) {
+	l, _, _ := newTestLedge()
+	if n, err := l.Write([]byte("abc\n")); n != 4 || err != nil {
+		t.Errorf("Write = %d, %v", n, err)
+	}
+}
+
+func TestStdLoggerHTTPErrorLog(t *testing.T) {
+	stderr := &lockedBuffer{}
+	l := New("test").WithOutput(&bytes.Buffer{}, stderr)
+	l.ColorOff()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("handler exploded")
+	}))
+	ts.Config.ErrorLog = l.StdLogger()
+	ts.Start()
+	defer ts.Close()
+	if resp, err := http.Get(ts.URL); err == nil {
+		resp.Body.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(stderr.String(), "handler exploded") {
+		if time.Now().After(deadline) {
+			t.Fatalf("server error not logged, stderr %q", stderr.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(stderr.String(), "[test] [ERROR] http: panic serving") {
+		t.Errorf("error line %q lacks the prefix and level", strings.SplitN(stderr.String(), "\n", 2)[0])
+	}
+}
+
+func TestNilLedge(t *testing.T) {
+	var l *Ledge
+	ran := 0
+	f := func() { ran++ }
+	l.Println("x")
+	l.Printf("x")
+	l.PrintfSampled(1, "x")
+	l.Debugf("x")
+	l.Debugln("x")
+	l.Errorf("x")
+	l.Errorln("x")
+	fmt.Fprintf(l, "x")
+	l.Time("t", f)
+	l.TimeAbove("t", 0, f)
+	l.TimeAbovePercentile("t", 50, f)
+	l.Record("t", f)
+	l.RecordAndPrint("t", f)
+	l.RecordFrom("t", "who", f)
+	l.RecordIO("t", 1, f)
+	l.RecordGoroutines("t", f)
+	if !l.RecordIf("t", func() bool { f(); return true }) {
+		t.Error("RecordIf did not pass through f's result")
+	}
+	if err := l.RecordOnSuccess("t", func() error { f(); return nil }); err != nil {
+		t.Error(err)
+	}
+	if v := l.RecordResultValue("t", func() float64 { f(); return 3 }); v != 3 {
+		t.Errorf("RecordResultValue = %v", v)
+	}
+	if ran != 11 {
+		t.Errorf("ran %d of 11 functions", ran)
+	}
+	l.RecordDuration("t", time.Second)
+	l.RecordValue("t", 1)
+	l.RecordBatch("t", []float64{1})
+	l.RecordDurations("t", []time.Duration{1})
+	l.Goroutines("t")
+	l.Stats("t")
+	l.Count("t")
+	l.Mean("t")
+	l.Median("t")
+	l.Perc("t", 99)
+	l.Perc("t", 150)
+	l.Min("t")
+	l.Max("t")
+	l.Variance("t")
+	l.StatsAll()
+	l.StatsBy("t")
+	l.PrintCompare(nil, nil)
+	l.RecordSLO("t", time.Second, true)
+	l.Tick("t")
+	l.StatsLine("t")
+	l.StatsUnion("t", "u")
+	l.StatsDelta("t")
+	l.PrintRatio("t", "u")
+	l.RecordBool("t", true)
+	if d := l.StartTimer("t").Stop(); d <= 0 {
+		t.Errorf("Stop = %v", d)
+	}
+	l.StartIntervalReport(time.Hour, func(string, StatsSummary) {})()
+	l.StdLogger().Printf("x")
+	if err := l.Flush(); err != nil {
+		t.Errorf("Flush = %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	var w bytes.Buffer
+	if err := l.StatsAllContext(context.Background(), &w); err != nil || w.Len() != 0 {
+		t.Errorf("StatsAllContext = %v, wrote %q", err, w.String())
+	}
+	for name, write := range map[string]func(io.Writer) error{
+		"StatsTree":        l.StatsTree,
+		"WriteBenchFormat": l.WriteBenchFormat,
+		"WriteHTMLReport":  l.WriteHTMLReport,
+	} {
+		if err := write(&w); err != nil || w.Len() != 0 {
+			t.Errorf("%s = %v, wrote %q", name, err, w.String())
+		}
+	}
+}
+
+func TestNilLedgePanics(t *testing.T) {
+	var l *Ledge
+	if r := mustPanic(t, func() { l.Panicf("bad %d", 1) }); r != "[PANIC] bad 1" {
+		t.Errorf("Panicf on nil panicked with %q", r)
+	}
+	mustPanic(t, func() { l.Check(errors.New("x")) })
+	l.Check(nil)
+}
+
+func TestStatsOnPanic(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.WithStatsOnPanic()
+	l.RecordValue("a", 1)
+	l.RecordValue("a", 3)
+	var seen string
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+			seen = stderr.String()
+		}()
+		l.Panicf("boom")
+	}()
+	got := lines(bytes.NewBufferString(seen))
+	if len(got) != 2 {
+		t.Fatalf("stderr before the panic propagated = %q", got)
+	}
+	if !strings.Contains(got[0], "boom") {
+		t.Errorf("first line %q, want the panic line", got[0])
+	}
+	if !strings.Contains(got[1], "[STATS a] count 2 ") || !strings.Contains(got[1], "mean 2.000000") {
+		t.Errorf("stats line %q", got[1])
+	}
+}
+
+func TestStatsOnPanicIgnoresLevelWriter(t *testing.T) {
+	l, stdout, stderr := newTestLedge()
+	var info bytes.Buffer
+	l.WithStatsOnPanic().WithLevelWriter(LevelInfo, &info)
+	l.RecordValue("a", 1)
+	mustPanic(t, func() { l.Panicln("boom") })
+	if !strings.Contains(stderr.String(), "[STATS a]") {
+		t.Errorf("stderr = %q, want the stats dump", stderr.String())
+	}
+	if info.Len() != 0 || stdout.Len() != 0 {
+		t.Errorf("stats dump rerouted: info %q stdout %q", info.String(), stdout.String())
+	}
+}
+
+func TestStatsOnPanicBuffered(t *testing.T) {
+	var stderr bytes.Buffer
+	l := New("test").WithOutput(&bytes.Buffer{}, &stderr).WithBufferedWriter(1<<20, 0).WithStatsOnPanic()
+	l.ColorOff()
+	l.StatsOn()
+	l.RecordValue("a", 1)
+	var seen string
+	func() {
+		defer func() {
+			recover()
+			seen = stderr.String()
+		}()
+		l.Panicf("boom")
+	}()
+	if !strings.Contains(seen, "[PANIC] boom") || !strings.Contains(seen, "[STATS a] count 1 ") {
+		t.Errorf("stderr before the panic propagated = %q, want the panic line and stats flushed", seen)
+	}
+}
+
+func TestStatsOnPanicOffByDefault(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.RecordValue("a", 1)
+	mustPanic(t, func() { l.Panicf("boom") })
+	if strings.Contains(stderr.String(), "[STATS") {
+		t.Errorf("stderr = %q, want no stats dump", stderr.String())
+	}
+}
+
+// stackErr is an error with a StackTrace method, as github.com/pkg/errors
+// errors have.
+type stackErr struct{}
+
+func (stackErr) Error() string { return "stack error" }
+
+func (stackErr) StackTrace() string { return "frame.of.origin" }
+
+func checkFromHelper(l *Ledge) {
+	l.Check(errors.New("bad"))
+}
+
+func TestCheckStackTrace(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithCheckStackTrace()
+	r := mustPanic(t, func() { checkFromHelper(l) })
+	msg := fmt.Sprint(r)
+	if !strings.Contains(msg, "bad") || !strings.Contains(msg, "ledge.checkFromHelper") {
+		t.Errorf("panic %q, want the error and the calling frame", msg)
+	}
+}
+
+func TestCheckStackTraceFromError(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithCheckStackTrace()
+	r := mustPanic(t, func() { l.CheckPrintf(stackErr{}, "context") })
+	msg := fmt.Sprint(r)
+	if !strings.HasSuffix(msg, "context\nframe.of.origin") {
+		t.Errorf("panic %q, want the error's own stack trace", msg)
+	}
+	r = mustPanic(t, func() { l.CheckPrintln(stackErr{}, "context") })
+	if msg := fmt.Sprint(r); !strings.Contains(msg, "frame.of.origin") {
+		t.Errorf("CheckPrintln panic %q, want the error's own stack trace", msg)
+	}
+}
+
+func TestCheckStackTraceOffByDefault(t *testing.T) {
+	l, _, _ := newTestLedge()
+	r := mustPanic(t, func() { checkFromHelper(l) })
+	if msg := fmt.Sprint(r); msg != "[PANIC] bad" {
+		t.Errorf("panic %q, want only the error", msg)
+	}
+}
+
+func TestMaxLineLength(t *testing.T) {
+	l, stdout, stderr := newTestLedge()
+	l.WithMaxLineLength(20)
+	l.Printf("%s", strings.Repeat("x", 100))
+	l.Errorln(strings.Repeat("y", 100))
+	l.Println("short")
+	out := lines(stdout)
+	want := strings.Repeat("x", 20-len(truncatedSuffix)) + truncatedSuffix
+	if len(out) != 2 || !strings.HasSuffix(out[0], " "+want) {
+		t.Errorf("stdout = %q, want a line ending in %q", out, want)
+	}
+	if !strings.HasSuffix(out[1], " short") {
+		t.Errorf("short line %q was changed", out[1])
+	}
+	if got := stderr.String(); !strings.Contains(got, strings.Repeat("y", 20-len(truncatedSuffix))+truncatedSuffix+"\n") {
+		t.Errorf("stderr = %q, want the truncated error", got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	msg := strings.Repeat("é", 20)
+	for _, n := range []int{1, 3, 5, 13, 14, 15, 16, 30} {
+		l := New("test").WithMaxLineLength(n)
+		got := l.truncate(msg)
+		if len(got) > n {
+			t.Errorf("n=%d: %q is %d bytes", n, got, len(got))
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("n=%d: %q splits a rune", n, got)
+		}
+		if n >= len(truncatedSuffix) && !strings.HasSuffix(got, truncatedSuffix) {
+			t.Errorf("n=%d: %q lacks the suffix", n, got)
+		}
+	}
+	if got := New("test").truncate(msg); got != msg {
+		t.Errorf("truncated to %q without a limit", got)
+	}
+}
+
+func TestMaxPlausible(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.DebugOn()
+	l.WithMaxPlausible(time.Minute, false)
+	l.RecordDuration("op", 3*time.Hour)
+	l.RecordDuration("op", time.Second)
+	if got := l.count("op"); got != 2 {
+		t.Errorf("kept %d samples, want both", got)
+	}
+	out := lines(stderr)
+	if len(out) != 1 || !strings.Contains(out[0], "implausible duration 3h0m0s recorded into op (limit 1m0s)") {
+		t.Errorf("stderr = %q, want one warning", out)
+	}
+}
+
+func TestMaxPlausibleDrop(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithMaxPlausible(time.Minute, true)
+	l.RecordDuration("op", 3*time.Hour)
+	l.RecordDurations("op", []time.Duration{time.Second, 2 * time.Hour, 2 * time.Second})
+	if !equalFloats(l.samples("op"), []float64{1000, 2000}) {
+		t.Errorf("samples = %v, want the implausible durations dropped", l.samples("op"))
+	}
+}
+
+func TestReportingAfterStatsOff(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("op", []float64{1, 3})
+	l.StatsOff()
+	l.RecordBatch("op", []float64{100})
+	l.Mean("op")
+	l.Count("op")
+	l.StatsLine("op")
+	got := lines(stdout)
+	if len(got) != 3 {
+		t.Fatalf("printed %q, want the retained samples reported", got)
+	}
+	for i, want := range []string{"[MEAN op] 2.000000", "[COUNT op] 2", "[STATS op] count 2 "} {
+		if !strings.Contains(got[i], want) {
+			t.Errorf("line %q lacks %q", got[i], want)
+		}
+	}
+}
+
+func TestReportingOff(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("op", []float64{1, 3})
+	l.ReportingOff()
+	l.Mean("op")
+	l.Stats("op")
+	l.StatsLine("op")
+	if stdout.Len() != 0 {
+		t.Errorf("printed %q with reporting off", stdout.String())
+	}
+	if l.count("op") != 2 {
+		t.Errorf("ReportingOff changed recording: %d samples", l.count("op"))
+	}
+	l.ReportingOn()
+	l.Mean("op")
+	if !strings.Contains(stdout.String(), "[MEAN op] 2.000000") {
+		t.Errorf("stdout = %q after ReportingOn", stdout.String())
+	}
+}
+
+func TestSignedValues(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	for _, v := range []float64{-3, 1.5, -0.5, 4, -2} {
+		l.RecordValue("jitter", v)
+	}
+	if !equalFloats(l.samples("jitter"), []float64{-3, 1.5, -0.5, 4, -2}) {
+		t.Fatalf("samples = %v, want every signed value kept", l.samples("jitter"))
+	}
+	l.Mean("jitter")
+	l.Min("jitter")
+	if got := lines(stdout); len(got) != 2 || !strings.HasSuffix(got[0], "[MEAN jitter] 0.000000") || !strings.HasSuffix(got[1], "[MIN jitter] -3.000000") {
+		t.Errorf("printed %q", got)
+	}
+	if max, ok := l.MaxAbs("jitter"); !ok || max != 4 {
+		t.Errorf("MaxAbs = %v, %v, want 4", max, ok)
+	}
+	l.RecordValue("early", -7)
+	l.RecordValue("early", -1)
+	if max, ok := l.MaxAbs("early"); !ok || max != 7 {
+		t.Errorf("MaxAbs of negative samples = %v, %v, want 7", max, ok)
+	}
+	if _, ok := l.MaxAbs("absent"); ok {
+		t.Error("MaxAbs reported a value for a tag without samples")
+	}
+}
+
+func TestWithProcessMetadata(t *testing.T) {
+	l, stdout, stderr := newTestLedge()
+	l.WithProcessMetadata().JSONOn()
+	l.Printf("hello")
+	l.Errorf("oops")
+	host, _ := os.Hostname()
+	for _, line := range append(lines(stdout), lines(stderr)...) {
+		var record struct {
+			Host string `json:"host"`
+			PID  int    `json:"pid"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Host != host || record.PID != os.Getpid() {
+			t.Errorf("record %s, want host %q and pid %d", line, host, os.Getpid())
+		}
+	}
+}
+
+func TestProcessMetadataOmittedByDefault(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.JSONOn()
+	l.Printf("hello")
+	if strings.Contains(stdout.String(), `"host"`) || strings.Contains(stdout.String(), `"pid"`) {
+		t.Errorf("process metadata without WithProcessMetadata: %q", stdout.String())
+	}
+}
@@ -0,0 +1,54 @@
+package ledge
+
+import (
+	"io"
+	"log"
+
+	. "github.com/logrusorgru/aurora/v3"
+)
+
+// Level is the severity of a line written by l.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+	LevelPanic
+	LevelFatal
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelError: "error",
+	LevelPanic: "panic",
+	LevelFatal: "fatal",
+}
+
+func (lv Level) String() string {
+	if name, ok := levelNames[lv]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// levelLabels are the colored labels prepended to text-mode lines of a level.
+var levelLabels = map[Level]Value{
+	LevelDebug: Cyan("[DEBUG]"),
+	LevelError: Red("[ERROR]"),
+	LevelPanic: Red("[PANIC]"),
+	LevelFatal: Red("[FATAL]"),
+}
+
+// WithLevelWriter sends lines of exactly level to w instead of l's stdout or
+// stderr; levels without a writer keep the defaults. To send errors and
+// worse to one file, map LevelError, LevelPanic and LevelFatal to it. Call it
+// before l is shared.
+func (l *Ledge) WithLevelWriter(level Level, w io.Writer) *Ledge {
+	if l.levelWriters == nil {
+		l.levelWriters = make(map[Level]*log.Logger)
+	}
+	l.levelWriters[level] = log.New(w, "", 0)
+	return l
+}
@@ -0,0 +1,62 @@
+package ledge
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWithLevelWriter(t *testing.T) {
+	l, stdout, stderr := newTestLedge()
+	var errs, debug bytes.Buffer
+	l.WithLevelWriter(LevelError, &errs).
+		WithLevelWriter(LevelPanic, &errs).
+		WithLevelWriter(LevelDebug, &debug)
+	l.DebugOn()
+	l.Println("info")
+	l.Debugf("debug")
+	l.Errorf("error")
+	mustPanic(t, func() { l.Panicf("panic") })
+	for _, c := range []struct {
+		name string
+		buf  *bytes.Buffer
+		want []string
+	}{
+		{"stdout", stdout, []string{"info"}},
+		{"stderr", stderr, nil},
+		{"errors", &errs, []string{"[ERROR] error", "[PANIC] panic"}},
+		{"debug", &debug, []string{"[DEBUG] debug"}},
+	} {
+		got := lines(c.buf)
+		if len(got) != len(c.want) {
+			t.Errorf("%s got %q, want %q", c.name, got, c.want)
+			continue
+		}
+		for i := range c.want {
+			if !strings.HasSuffix(got[i], c.want[i]) {
+				t.Errorf("%s line %q, want suffix %q", c.name, got[i], c.want[i])
+			}
+		}
+	}
+}
+
+func TestWithLevelWriterStats(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	var info bytes.Buffer
+	l.WithLevelWriter(LevelInfo, &info)
+	l.RecordValue("a", 1)
+	l.Count("a")
+	if stdout.Len() != 0 || !strings.Contains(info.String(), "[COUNT a] 1") {
+		t.Errorf("stdout %q, info %q, want stats on the info writer", stdout.String(), info.String())
+	}
+}
+
+func TestWithLevelWriterJSON(t *testing.T) {
+	l, _, _ := newTestLedge()
+	var errs bytes.Buffer
+	l.WithLevelWriter(LevelError, &errs).JSONOn()
+	l.Errorf("oops")
+	if got := errs.String(); !strings.Contains(got, `"level":"error"`) || !strings.Contains(got, `"msg":"oops"`) {
+		t.Errorf("error writer got %q", got)
+	}
+}
@@ -0,0 +1,96 @@
+package ledge
+
+import (
+	"time"
+)
+
+// sampleBytes is the memory held by one recorded sample.
+const sampleBytes = 8
+
+// WithMemoryBudget caps the approximate memory held by all tags' records at
+// bytes. When a record pushes the total over budget, the least recently
+// recorded other tags are evicted until it fits again, and if the recorded
+// tag alone is over budget its oldest samples are dropped. Only records are
+// counted: the sorted copy cached for percentile queries can hold up to as
+// much again for tags that were queried since their last record.
+func (l *Ledge) WithMemoryBudget(bytes int) *Ledge {
+	l.recordsLock.Lock()
+	defer l.recordsLock.Unlock()
+	l.memoryBudget = bytes
+	l.recordedBytes = 0
+	l.lastRecorded = make(map[string]uint64)
+	for tag, records := range l.records {
+		l.recordedBytes += len(records) * sampleBytes
+		l.lastRecorded[tag] = 0
+	}
+	return l
+}
+
+// account notes that n samples were just appended to tag and evicts other
+// tags until the memory budget is met, returning the evicted tags. tag itself
+// is never evicted; if it alone is over budget, its oldest samples are
+// dropped instead. The records lock must be held.
+func (l *Ledge) account(tag string, n int) []string {
+	if l.memoryBudget <= 0 {
+		return nil
+	}
+	l.recordSeq++
+	l.lastRecorded[tag] = l.recordSeq
+	l.recordedBytes += n * sampleBytes
+	var evicted []string
+	for l.recordedBytes > l.memoryBudget && len(l.lastRecorded) > 1 {
+		oldest := ""
+		for t, seq := range l.lastRecorded {
+			if t != tag && (oldest == "" || seq < l.lastRecorded[oldest]) {
+				oldest = t
+			}
+		}
+		l.recordedBytes -= len(l.records[oldest]) * sampleBytes
+		delete(l.records, oldest)
+		delete(l.sorted, oldest)
+		delete(l.slo, oldest)
+		delete(l.sources, oldest)
+		delete(l.instants, oldest)
+		delete(l.kinds, oldest)
+		delete(l.stamps, oldest)
+		delete(l.rollups, oldest)
+		delete(l.deltaCursors, oldest)
+		delete(l.lastRecorded, oldest)
+		evicted = append(evicted, oldest)
+	}
+	if over := l.recordedBytes - l.memoryBudget; over > 0 {
+		l.trimOldest(tag, (over+sampleBytes-1)/sampleBytes)
+	}
+	return evicted
+}
+
+// trimOldest drops the n oldest samples of tag. The records lock must be
+// held.
+func (l *Ledge) trimOldest(tag string, n int) {
+	records := l.records[tag]
+	if n > len(records) {
+		n = len(records)
+	}
+	l.records[tag] = append([]float64(nil), records[n:]...)
+	delete(l.sorted, tag)
+	l.recordedBytes -= n * sampleBytes
+	if stamps, ok := l.stamps[tag]; ok && len(stamps) >= n {
+		l.stamps[tag] = append([]time.Time(nil), stamps[n:]...)
+	}
+	if cursor, ok := l.deltaCursors[tag]; ok {
+		if cursor -= n; cursor < 0 {
+			cursor = 0
+		}
+		l.deltaCursors[tag] = cursor
+	}
+}
+
+// unaccount notes that tag's records are about to be dropped. The records
+// lock must be held.
+func (l *Ledge) unaccount(tag string) {
+	if l.memoryBudget <= 0 {
+		return
+	}
+	l.recordedBytes -= len(l.records[tag]) * sampleBytes
+	delete(l.lastRecorded, tag)
+}
@@ -0,0 +1,71 @@
+package ledge
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBudgetEvictsLRU(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.DebugOn()
+	const budget = 10 * 4 * sampleBytes
+	l.WithMemoryBudget(budget)
+	for i := 0; i < 100; i++ {
+		l.RecordBatch(fmt.Sprintf("tag%d", i), []float64{1, 2, 3, 4})
+		if l.recordedBytes > budget {
+			t.Fatalf("after tag%d, %d bytes recorded, over the %d budget", i, l.recordedBytes, budget)
+		}
+	}
+	total := 0
+	for _, tag := range l.tags() {
+		total += l.count(tag) * sampleBytes
+	}
+	if total > budget || total != l.recordedBytes {
+		t.Errorf("records hold %d bytes, accounted %d, budget %d", total, l.recordedBytes, budget)
+	}
+	if l.count("tag0") != 0 || l.count("tag99") != 4 {
+		t.Error("eviction did not remove the least recently recorded tags")
+	}
+	if !strings.Contains(stderr.String(), "evicted records of tag0") {
+		t.Errorf("no debug line for the eviction in %q", stderr.String())
+	}
+}
+
+func TestMemoryBudgetRecency(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithMemoryBudget(3 * sampleBytes)
+	l.RecordValue("a", 1)
+	l.RecordValue("b", 1)
+	l.RecordValue("c", 1)
+	l.RecordValue("a", 2)
+	if l.count("b") != 0 || l.count("a") != 2 || l.count("c") != 1 {
+		t.Errorf("counts a=%d b=%d c=%d, want b evicted as least recently recorded", l.count("a"), l.count("b"), l.count("c"))
+	}
+	l.RecordValue("d", 1)
+	if l.count("c") != 0 || l.count("a") != 2 || l.count("d") != 1 {
+		t.Errorf("counts a=%d c=%d d=%d, want c evicted", l.count("a"), l.count("c"), l.count("d"))
+	}
+}
+
+func TestMemoryBudgetKeepsRecordedTag(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithMemoryBudget(2 * sampleBytes)
+	l.RecordBatch("a", []float64{1, 2, 3})
+	if got := l.samples("a"); !equalFloats(got, []float64{2, 3}) {
+		t.Errorf("samples = %v, want the newest two", got)
+	}
+	if l.recordedBytes != 2*sampleBytes {
+		t.Errorf("recordedBytes = %d", l.recordedBytes)
+	}
+}
+
+func TestMemoryBudgetClearRecords(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithMemoryBudget(100 * sampleBytes)
+	l.RecordBatch("a", []float64{1, 2, 3})
+	l.ClearRecords("a")
+	if l.recordedBytes != 0 {
+		t.Errorf("recordedBytes = %d after ClearRecords", l.recordedBytes)
+	}
+}
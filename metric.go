@@ -0,0 +1,80 @@
+package ledge
+
+import "fmt"
+
+// Metric is a statistic that Stats can print.
+type Metric int
+
+const (
+	MetricCount Metric = iota
+	MetricMin
+	MetricMedian
+	MetricP99
+	MetricMax
+	MetricMean
+	MetricVariance
+)
+
+func (m Metric) String() string {
+	switch m {
+	case MetricCount:
+		return "count"
+	case MetricMin:
+		return "min"
+	case MetricMedian:
+		return "median"
+	case MetricP99:
+		return "p99"
+	case MetricMax:
+		return "max"
+	case MetricMean:
+		return "mean"
+	case MetricVariance:
+		return "variance"
+	}
+	return "unknown"
+}
+
+// defaultStatsOrder is what Stats prints unless changed with WithStatsOrder.
+var defaultStatsOrder = []Metric{MetricCount, MetricMin, MetricMedian, MetricP99, MetricMax, MetricMean, MetricVariance}
+
+// WithStatsOrder sets which metrics Stats prints and in what order. Call it
+// before l is shared.
+func (l *Ledge) WithStatsOrder(metrics ...Metric) *Ledge {
+	l.statsOrder = metrics
+	return l
+}
+
+// printMetric prints metric m of tag from s, a single summary shared by all
+// of the metrics one Stats call prints, so they describe the same samples
+// whatever order they are printed in.
+func (l *Ledge) printMetric(tag string, s StatsSummary, m Metric) {
+	var tagString string
+	var v float64
+	switch m {
+	case MetricCount:
+		l.emitStat(fmt.Sprintf("[COUNT %s]", tag), fmt.Sprintf("%d", s.Count))
+		return
+	case MetricMin:
+		tagString, v = fmt.Sprintf("[MIN %s]", tag), s.Min
+	case MetricMedian:
+		tagString, v = fmt.Sprintf("[MEDIAN %s]", tag), s.Median
+	case MetricP99:
+		tagString, v = fmt.Sprintf("[PERC-99 %s]", tag), s.P99
+	case MetricMax:
+		tagString, v = fmt.Sprintf("[MAX %s]", tag), s.Max
+	case MetricMean:
+		tagString, v = fmt.Sprintf("[MEAN %s]", tag), s.Mean
+	case MetricVariance:
+		tagString, v = fmt.Sprintf("[VARIANCE %s]", tag), s.Variance
+	default:
+		return
+	}
+	switch m {
+	case MetricMedian, MetricP99, MetricVariance:
+		if l.insufficient(tagString, s.Count) {
+			return
+		}
+	}
+	l.emitStat(tagString, fmt.Sprintf("%f", v))
+}
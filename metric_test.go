@@ -0,0 +1,94 @@
+package ledge
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// statLines returns the captured lines without their timestamps.
+func statLines(t *testing.T, out []string) []string {
+	t.Helper()
+	var stripped []string
+	for _, line := range out {
+		i := strings.Index(line, " ")
+		if i < 0 {
+			t.Fatalf("line %q has no timestamp", line)
+		}
+		stripped = append(stripped, line[i+1:])
+	}
+	return stripped
+}
+
+func TestWithStatsOrder(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithClock(newFakeClock())
+	l.WithStatsOrder(MetricMax, MetricCount, MetricMean)
+	l.RecordBatch("a", []float64{1, 2, 6})
+	l.Stats("a")
+	want := []string{
+		"[test] [MAX a] 6.000000",
+		"[test] [COUNT a] 3",
+		"[test] [MEAN a] 3.000000",
+	}
+	if got := statLines(t, lines(stdout)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDefaultStatsOrder(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1, 2, 3, 4})
+	l.Stats("a")
+	want := []string{
+		"[test] [COUNT a] 4",
+		"[test] [MIN a] 1.000000",
+		"[test] [MEDIAN a] 2.500000",
+		"[test] [PERC-99 a] 4.000000",
+		"[test] [MAX a] 4.000000",
+		"[test] [MEAN a] 2.500000",
+		"[test] [VARIANCE a] 1.250000",
+	}
+	if got := statLines(t, lines(stdout)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMetricString(t *testing.T) {
+	var names []string
+	for _, m := range defaultStatsOrder {
+		names = append(names, m.String())
+	}
+	if got := strings.Join(names, ","); got != "count,min,median,p99,max,mean,variance" {
+		t.Errorf("names = %s", got)
+	}
+	if Metric(100).String() != "unknown" {
+		t.Error("unknown metric has a name")
+	}
+}
+
+func TestStatsGolden(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithClock(newFakeClock()).WithUTC().WithTimeFormat(time.RFC3339)
+	l.RecordBatch("a", []float64{4, 1, 3, 2})
+	l.Stats("a")
+	l.Stats("empty")
+	l.WithStatsOrder(MetricMax, MetricCount)
+	l.Stats("a")
+	l.Stats("empty")
+	const want = `2020-01-01T00:00:00Z [test] [COUNT a] 4
+2020-01-01T00:00:00Z [test] [MIN a] 1.000000
+2020-01-01T00:00:00Z [test] [MEDIAN a] 2.500000
+2020-01-01T00:00:00Z [test] [PERC-99 a] 4.000000
+2020-01-01T00:00:00Z [test] [MAX a] 4.000000
+2020-01-01T00:00:00Z [test] [MEAN a] 2.500000
+2020-01-01T00:00:00Z [test] [VARIANCE a] 1.250000
+2020-01-01T00:00:00Z [test] [STATS empty] no samples
+2020-01-01T00:00:00Z [test] [MAX a] 4.000000
+2020-01-01T00:00:00Z [test] [COUNT a] 4
+2020-01-01T00:00:00Z [test] [STATS empty] no samples
+`
+	if got := stdout.String(); got != want {
+		t.Errorf("Stats printed\n%s\nwant\n%s", got, want)
+	}
+}
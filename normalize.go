@@ -0,0 +1,118 @@
+package ledge
+
+import (
+	"sort"
+	"time"
+)
+
+// WithTagNormalizer applies normalize to the tag of every record, e.g.
+// strings.ToLower, so near-duplicate tags land in one place. Call it before
+// l is shared.
+func (l *Ledge) WithTagNormalizer(normalize func(string) string) *Ledge {
+	l.normalizer = normalize
+	return l
+}
+
+func (l *Ledge) normalize(tag string) string {
+	if l.normalizer == nil {
+		return tag
+	}
+	return l.normalizer(tag)
+}
+
+// NormalizeExistingTags merges tags recorded before the normalizer was set
+// that normalize to the same name. Samples not yet rolled up are merged in
+// time order; interval summaries already made by WithRollup cannot be
+// combined, so those of the merged tags are kept side by side in interval
+// order. A tag that is only renamed keeps its SummaryDelta cursor, but the
+// cursor of a merged tag is reset, so its next delta covers all its samples.
+func (l *Ledge) NormalizeExistingTags() {
+	if l.normalizer == nil {
+		return
+	}
+	l.recordsLock.Lock()
+	defer l.recordsLock.Unlock()
+	records := make(map[string][]float64, len(l.records))
+	stamps := make(map[string][]time.Time, len(l.stamps))
+	members := make(map[string]int)
+	for tag := range l.records {
+		members[l.normalizer(tag)]++
+	}
+	cursors := make(map[string]int)
+	for _, tag := range sortedKeys(l.records) {
+		n := l.normalizer(tag)
+		if cursor, ok := l.deltaCursors[tag]; ok && members[n] == 1 {
+			cursors[n] = cursor
+		}
+		if l.stamps != nil {
+			records[n], stamps[n] = mergeByTime(records[n], stamps[n], l.records[tag], l.stamps[tag])
+		} else {
+			records[n] = append(records[n], l.records[tag]...)
+		}
+		if rollups, ok := l.rollups[tag]; ok && n != tag {
+			delete(l.rollups, tag)
+			merged := append(l.rollups[n], rollups...)
+			sort.SliceStable(merged, func(i, j int) bool {
+				return merged[i].Start.Before(merged[j].Start)
+			})
+			l.rollups[n] = merged
+		}
+		if by, ok := l.sources[tag]; ok && n != tag {
+			delete(l.sources, tag)
+			if l.sources[n] == nil {
+				l.sources[n] = make(map[string][]float64)
+			}
+			for who, samples := range by {
+				l.sources[n][who] = append(l.sources[n][who], samples...)
+			}
+		}
+		if counts, ok := l.slo[tag]; ok && n != tag {
+			delete(l.slo, tag)
+			if l.slo[n] == nil {
+				l.slo[n] = &sloCounts{}
+			}
+			l.slo[n].successes += counts.successes
+			l.slo[n].failures += counts.failures
+		}
+		if instants, ok := l.instants[tag]; ok && n != tag {
+			delete(l.instants, tag)
+			l.instants[n] += instants
+		}
+		if k, ok := l.kinds[tag]; ok && n != tag {
+			delete(l.kinds, tag)
+			if _, ok := l.kinds[n]; !ok {
+				l.kinds[n] = k
+			}
+		}
+		if seq, ok := l.lastRecorded[tag]; ok && n != tag {
+			delete(l.lastRecorded, tag)
+			if seq > l.lastRecorded[n] {
+				l.lastRecorded[n] = seq
+			}
+		}
+	}
+	l.records = records
+	l.sorted = make(map[string][]float64)
+	l.deltaCursors = cursors
+	if l.stamps != nil {
+		l.stamps = stamps
+	}
+}
+
+// mergeByTime merges two runs of samples, each in timestamp order, into one
+// run in timestamp order, as rollup expects. Ties keep a's samples first.
+func mergeByTime(a []float64, aStamps []time.Time, b []float64, bStamps []time.Time) ([]float64, []time.Time) {
+	records := make([]float64, 0, len(a)+len(b))
+	stamps := make([]time.Time, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if j == len(b) || (i < len(a) && !bStamps[j].Before(aStamps[i])) {
+			records, stamps = append(records, a[i]), append(stamps, aStamps[i])
+			i++
+		} else {
+			records, stamps = append(records, b[j]), append(stamps, bStamps[j])
+			j++
+		}
+	}
+	return records, stamps
+}
@@ -0,0 +1,50 @@
+package ledge
+
+import (
+	"strings"
+	"testing"
+)
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func TestWithTagNormalizer(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithTagNormalizer(normalizeTag)
+	l.RecordValue("DB.Query", 1)
+	l.RecordValue("db.query ", 2)
+	l.RecordValue(" db.query", 3)
+	if got := l.tags(); len(got) != 1 || got[0] != "db.query" {
+		t.Fatalf("tags = %q, want just db.query", got)
+	}
+	if l.count("db.query") != 3 {
+		t.Errorf("count = %d, want 3", l.count("db.query"))
+	}
+}
+
+func TestNormalizeExistingTags(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("DB.Query", []float64{1, 2})
+	l.RecordBatch("db.query ", []float64{3})
+	l.RecordBatch("db.query", []float64{4})
+	l.RecordBatch("other", []float64{5})
+	l.WithTagNormalizer(normalizeTag).NormalizeExistingTags()
+	if got := l.tags(); strings.Join(got, ",") != "db.query,other" {
+		t.Fatalf("tags = %q", got)
+	}
+	s, _ := l.Summary("db.query")
+	if s.Count != 4 || s.Min != 1 || s.Max != 4 {
+		t.Errorf("merged summary = %+v", s)
+	}
+}
+
+func TestNormalizeExistingTagsWithoutNormalizer(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("A", []float64{1})
+	l.RecordBatch("a", []float64{1})
+	l.NormalizeExistingTags()
+	if len(l.tags()) != 2 {
+		t.Errorf("tags merged without a normalizer: %q", l.tags())
+	}
+}
@@ -0,0 +1,94 @@
+package ledge
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/montanaflynn/stats"
+)
+
+// Ratio returns the number of samples in numerTag divided by the number in
+// denomTag, or false if denomTag has none.
+func (l *Ledge) Ratio(numerTag, denomTag string) (float64, bool) {
+	denom := l.count(denomTag)
+	if denom == 0 {
+		return 0, false
+	}
+	return float64(l.count(numerTag)) / float64(denom), true
+}
+
+func (l *Ledge) PrintRatio(numerTag, denomTag string) {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		r, ok := l.Ratio(numerTag, denomTag)
+		if !ok {
+			return
+		}
+		tagString := fmt.Sprintf("[RATIO %s/%s]", numerTag, denomTag)
+		l.emitStat(tagString, fmt.Sprintf("%f", r))
+	}
+}
+
+// RecordBool records success into tag as 1 or 0, for use with SuccessRate.
+func (l *Ledge) RecordBool(tag string, success bool) {
+	v := 0.0
+	if success {
+		v = 1
+	}
+	l.RecordValue(tag, v)
+}
+
+// SuccessRate returns the percentage of true samples recorded into tag with
+// RecordBool, or false if it has none.
+func (l *Ledge) SuccessRate(tag string) (float64, bool) {
+	records := l.samples(tag)
+	if len(records) == 0 {
+		return 0, false
+	}
+	mean, _ := stats.Mean(records)
+	return mean * 100, true
+}
+
+func (l *Ledge) PrintSuccessRate(tag string) {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		rate, ok := l.SuccessRate(tag)
+		if !ok {
+			return
+		}
+		tagString := fmt.Sprintf("[SUCCESS %s]", tag)
+		l.emitStat(tagString, fmt.Sprintf("%.2f%%", rate))
+	}
+}
+
+// Correlation returns the Pearson correlation coefficient of tagA's and
+// tagB's samples, paired in recording order up to the shorter of the two. It
+// returns false with fewer than two pairs or if either side is constant.
+func (l *Ledge) Correlation(tagA, tagB string) (float64, bool) {
+	a, b := l.samples(tagA), l.samples(tagB)
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n < 2 {
+		return 0, false
+	}
+	a, b = a[:n], b[:n]
+	meanA, _ := stats.Mean(a)
+	meanB, _ := stats.Mean(b)
+	var cov, varA, varB float64
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varA*varB), true
+}
@@ -0,0 +1,83 @@
+package ledge
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRatio(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("hits", []float64{1, 1, 1})
+	l.RecordBatch("requests", []float64{1, 1, 1, 1})
+	if r, ok := l.Ratio("hits", "requests"); !ok || r != 0.75 {
+		t.Errorf("Ratio = %v, %v, want 0.75", r, ok)
+	}
+	l.PrintRatio("hits", "requests")
+	if !strings.HasSuffix(strings.TrimSpace(stdout.String()), "[RATIO hits/requests] 0.750000") {
+		t.Errorf("PrintRatio printed %q", stdout.String())
+	}
+}
+
+func TestRatioZeroDenominator(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("hits", []float64{1})
+	if _, ok := l.Ratio("hits", "none"); ok {
+		t.Error("Ratio with an empty denominator reported ok")
+	}
+	l.PrintRatio("hits", "none")
+	if stdout.Len() != 0 {
+		t.Errorf("PrintRatio printed %q for an empty denominator", stdout.String())
+	}
+	if r, ok := l.Ratio("none", "hits"); !ok || r != 0 {
+		t.Errorf("Ratio with an empty numerator = %v, %v, want 0", r, ok)
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	for _, ok := range []bool{true, false, true, true, false, true, true, true} {
+		l.RecordBool("login", ok)
+	}
+	if rate, ok := l.SuccessRate("login"); !ok || rate != 75 {
+		t.Errorf("SuccessRate = %v, %v, want 75", rate, ok)
+	}
+	l.PrintSuccessRate("login")
+	if !strings.HasSuffix(strings.TrimSpace(stdout.String()), "[SUCCESS login] 75.00%") {
+		t.Errorf("PrintSuccessRate printed %q", stdout.String())
+	}
+	if _, ok := l.SuccessRate("none"); ok {
+		t.Error("SuccessRate of an empty tag reported ok")
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("x", []float64{1, 2, 3, 4, 5})
+	l.RecordBatch("up", []float64{3, 5, 7, 9, 11})
+	l.RecordBatch("down", []float64{10, 8, 6, 4, 2})
+	l.RecordBatch("flat", []float64{2, 2, 2, 2, 2})
+	l.RecordBatch("unrelated", []float64{1, -1, 0, -1, 1})
+	l.RecordBatch("longer", []float64{2, 4, 6, 8, 10, -100, 100})
+	for _, c := range []struct {
+		b    string
+		want float64
+	}{
+		{"up", 1},
+		{"down", -1},
+		{"unrelated", 0},
+		{"longer", 1},
+	} {
+		got, ok := l.Correlation("x", c.b)
+		if !ok || math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("Correlation(x, %s) = %v, %v, want %v", c.b, got, ok, c.want)
+		}
+	}
+	if _, ok := l.Correlation("x", "flat"); ok {
+		t.Error("Correlation with a constant tag reported a coefficient")
+	}
+	l.RecordBatch("one", []float64{1})
+	if _, ok := l.Correlation("x", "one"); ok {
+		t.Error("Correlation of a single pair reported a coefficient")
+	}
+}
@@ -0,0 +1,76 @@
+package ledge
+
+import (
+	"time"
+)
+
+// RollupHistory is how many interval summaries WithRollup keeps per tag.
+const RollupHistory = 1440
+
+// IntervalStats summarizes the samples a tag received in [Start, End).
+type IntervalStats struct {
+	Start time.Time
+	End   time.Time
+	StatsSummary
+}
+
+// WithRollup bounds long-running memory use: samples are timestamped with
+// l's clock, and once an interval (aligned to multiples of interval) has
+// passed, its raw samples are replaced by an IntervalStats, of which the
+// latest RollupHistory are kept per tag. Call it before any records are made.
+func (l *Ledge) WithRollup(interval time.Duration) *Ledge {
+	l.rollupInterval = interval
+	l.stamps = make(map[string][]time.Time)
+	l.rollups = make(map[string][]IntervalStats)
+	return l
+}
+
+// Rollups returns tag's interval summaries, oldest first.
+func (l *Ledge) Rollups(tag string) []IntervalStats {
+	if l.rollupInterval <= 0 {
+		return nil
+	}
+	l.recordsLock.Lock()
+	defer l.recordsLock.Unlock()
+	l.rollup(tag, l.clock.Now())
+	return append([]IntervalStats(nil), l.rollups[tag]...)
+}
+
+// rollup summarizes and drops tag's samples from intervals that ended by now.
+// The records lock must be held.
+func (l *Ledge) rollup(tag string, now time.Time) {
+	current := now.Truncate(l.rollupInterval)
+	stamps, records := l.stamps[tag], l.records[tag]
+	done := 0
+	for done < len(stamps) && stamps[done].Before(current) {
+		start := stamps[done].Truncate(l.rollupInterval)
+		end := done
+		for end < len(stamps) && stamps[end].Truncate(l.rollupInterval).Equal(start) {
+			end++
+		}
+		l.rollups[tag] = append(l.rollups[tag], IntervalStats{
+			Start:        start,
+			End:          start.Add(l.rollupInterval),
+			StatsSummary: summarize(records[done:end]),
+		})
+		done = end
+	}
+	if done == 0 {
+		return
+	}
+	if n := len(l.rollups[tag]); n > RollupHistory {
+		l.rollups[tag] = append([]IntervalStats(nil), l.rollups[tag][n-RollupHistory:]...)
+	}
+	l.stamps[tag] = append([]time.Time(nil), stamps[done:]...)
+	l.records[tag] = append([]float64(nil), records[done:]...)
+	delete(l.sorted, tag)
+	if l.memoryBudget > 0 {
+		l.recordedBytes -= done * sampleBytes
+	}
+	if cursor, ok := l.deltaCursors[tag]; ok {
+		if cursor -= done; cursor < 0 {
+			cursor = 0
+		}
+		l.deltaCursors[tag] = cursor
+	}
+}
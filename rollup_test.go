@@ -0,0 +1,91 @@
+package ledge
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollups(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock).WithRollup(10 * time.Second)
+	start := clock.Now()
+	l.RecordBatch("a", []float64{1, 2, 3})
+	clock.Advance(5 * time.Second)
+	l.RecordBatch("a", []float64{4})
+	clock.Advance(10 * time.Second)
+	l.RecordBatch("a", []float64{10, 20})
+	clock.Advance(20 * time.Second)
+	l.RecordBatch("a", []float64{100})
+
+	rollups := l.Rollups("a")
+	if len(rollups) != 2 {
+		t.Fatalf("got %d rollups, want 2: %+v", len(rollups), rollups)
+	}
+	first, second := rollups[0], rollups[1]
+	if !first.Start.Equal(start) || !first.End.Equal(start.Add(10*time.Second)) {
+		t.Errorf("first interval [%v, %v)", first.Start, first.End)
+	}
+	if first.Count != 4 || first.Min != 1 || first.Max != 4 || first.Mean != 2.5 {
+		t.Errorf("first rollup %+v", first.StatsSummary)
+	}
+	if !second.Start.Equal(start.Add(10*time.Second)) || second.Count != 2 || second.Mean != 15 {
+		t.Errorf("second rollup %+v", second)
+	}
+	if got := l.samples("a"); !equalFloats(got, []float64{100}) {
+		t.Errorf("raw samples = %v, want only the current interval's", got)
+	}
+	clock.Advance(10 * time.Second)
+	if rollups := l.Rollups("a"); len(rollups) != 3 || rollups[2].Count != 1 {
+		t.Errorf("Rollups did not roll up the finished interval: %+v", rollups)
+	}
+}
+
+func TestRollupHistoryBounded(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock).WithRollup(time.Second)
+	for i := 0; i < RollupHistory+10; i++ {
+		l.RecordValue("a", float64(i))
+		clock.Advance(time.Second)
+	}
+	rollups := l.Rollups("a")
+	if len(rollups) != RollupHistory {
+		t.Fatalf("kept %d rollups, want %d", len(rollups), RollupHistory)
+	}
+	if rollups[0].Min != 10 {
+		t.Errorf("oldest kept rollup %+v, want the oldest ones dropped", rollups[0])
+	}
+}
+
+func TestRollupsDisabled(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordValue("a", 1)
+	if got := l.Rollups("a"); got != nil {
+		t.Errorf("Rollups without WithRollup = %v", got)
+	}
+}
+
+func TestRollupsAfterNormalize(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock).WithRollup(10 * time.Second)
+	l.RecordValue("a", 1)
+	clock.Advance(5 * time.Second)
+	l.RecordValue("a", 2)
+	clock.Advance(7 * time.Second)
+	l.RecordValue("A", 3)
+	l.WithTagNormalizer(strings.ToLower).NormalizeExistingTags()
+	clock.Advance(10 * time.Second)
+	rollups := l.Rollups("a")
+	if len(rollups) != 2 {
+		t.Fatalf("got %d rollups, want one per interval: %+v", len(rollups), rollups)
+	}
+	if !rollups[0].Start.Before(rollups[1].Start) {
+		t.Errorf("rollups out of order: %+v", rollups)
+	}
+	if rollups[0].Count != 2 || rollups[0].Mean != 1.5 || rollups[1].Count != 1 || rollups[1].Mean != 3 {
+		t.Errorf("rollups %+v", rollups)
+	}
+}
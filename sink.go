@@ -0,0 +1,70 @@
+package ledge
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// OnSample registers f to be called with every sample as it is recorded. f
+// runs without the records lock held, on the recording goroutine. Call it
+// before l is shared.
+func (l *Ledge) OnSample(f func(tag string, value float64)) *Ledge {
+	l.sampleHooks = append(l.sampleHooks, f)
+	return l
+}
+
+// WithSampleSink writes every sample to w as it is recorded, one
+// "tag value" line per sample. Call it before l is shared.
+func (l *Ledge) WithSampleSink(w io.Writer) *Ledge {
+	lock := &sync.Mutex{}
+	return l.OnSample(func(tag string, value float64) {
+		lock.Lock()
+		defer lock.Unlock()
+		fmt.Fprintf(w, "%s %v\n", tag, value)
+	})
+}
+
+func (l *Ledge) sampled(tag string, values []float64) {
+	for _, hook := range l.sampleHooks {
+		for _, v := range values {
+			hook(tag, v)
+		}
+	}
+}
+
+// Sample is one timestamped value, as replayed by Replay.
+type Sample struct {
+	At    time.Time
+	Value float64
+}
+
+// sleeper is implemented by clocks that can also wait, so that Replay can be
+// driven by a fake clock in tests.
+type sleeper interface {
+	Sleep(d time.Duration)
+}
+
+// Replay passes samples to the OnSample callbacks and sample sinks in order,
+// as if they were being recorded into tag, waiting between them for their
+// original gaps divided by speed. A speed of zero or less replays without
+// waiting. If l's clock has a Sleep method it is used to wait. The records
+// themselves are left untouched.
+func (l *Ledge) Replay(tag string, samples []Sample, speed float64) {
+	if l == nil {
+		return
+	}
+	sleep := time.Sleep
+	if s, ok := l.clock.(sleeper); ok {
+		sleep = s.Sleep
+	}
+	for i, sample := range samples {
+		if i > 0 && speed > 0 {
+			if gap := sample.At.Sub(samples[i-1].At); gap > 0 {
+				sleep(time.Duration(float64(gap) / speed))
+			}
+		}
+		l.sampled(tag, []float64{sample.Value})
+	}
+}
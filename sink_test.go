@@ -0,0 +1,101 @@
+package ledge
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWithSampleSink(t *testing.T) {
+	l, _, _ := newTestLedge()
+	var sink bytes.Buffer
+	l.WithSampleSink(&sink)
+	l.RecordValue("a", 1.5)
+	l.RecordBatch("b", []float64{2, 3})
+	l.RecordValue("a", -4)
+	want := "a 1.5\nb 2\nb 3\na -4\n"
+	if sink.String() != want {
+		t.Errorf("sink got %q, want %q", sink.String(), want)
+	}
+}
+
+func TestOnSampleWithoutLock(t *testing.T) {
+	l, _, _ := newTestLedge()
+	var seen []int
+	l.OnSample(func(tag string, value float64) {
+		// Reading records would deadlock if the records lock were held.
+		seen = append(seen, l.count(tag))
+	})
+	l.RecordValue("a", 1)
+	l.RecordValue("a", 2)
+	if len(seen) != 2 || seen[0] != 1 || seen[1] != 2 {
+		t.Errorf("callback saw counts %v, want [1 2]", seen)
+	}
+}
+
+func TestOnSampleStatsOff(t *testing.T) {
+	l, _, _ := newTestLedge()
+	calls := 0
+	l.OnSample(func(string, float64) { calls++ })
+	l.StatsOff()
+	l.RecordValue("a", 1)
+	if calls != 0 {
+		t.Errorf("callback ran %d times with stats off", calls)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock)
+	var sink bytes.Buffer
+	l.WithSampleSink(&sink)
+	start := clock.Now()
+	var at []time.Duration
+	var values []float64
+	l.OnSample(func(tag string, value float64) {
+		if tag != "replayed" {
+			t.Errorf("replayed into %q", tag)
+		}
+		at = append(at, clock.Now().Sub(start))
+		values = append(values, value)
+	})
+	t0 := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		{At: t0, Value: 1},
+		{At: t0.Add(4 * time.Second), Value: 2},
+		{At: t0.Add(10 * time.Second), Value: 3},
+	}
+	l.Replay("replayed", samples, 2)
+	if !equalFloats(values, []float64{1, 2, 3}) {
+		t.Errorf("replayed %v, want [1 2 3]", values)
+	}
+	want := []time.Duration{0, 2 * time.Second, 5 * time.Second}
+	if len(at) != len(want) {
+		t.Fatalf("callback times %v", at)
+	}
+	for i := range want {
+		if at[i] != want[i] {
+			t.Errorf("sample %d replayed at %v, want %v", i, at[i], want[i])
+		}
+	}
+	if sink.String() != "replayed 1\nreplayed 2\nreplayed 3\n" {
+		t.Errorf("sink got %q", sink.String())
+	}
+	if l.count("replayed") != 0 {
+		t.Errorf("Replay recorded %d samples", l.count("replayed"))
+	}
+}
+
+func TestReplayNoWait(t *testing.T) {
+	l, _, _ := newTestLedge()
+	clock := newFakeClock()
+	l.WithClock(clock)
+	calls := 0
+	l.OnSample(func(string, float64) { calls++ })
+	t0 := clock.Now()
+	l.Replay("replayed", []Sample{{At: t0, Value: 1}, {At: t0.Add(time.Hour), Value: 2}}, 0)
+	if calls != 2 || !clock.Now().Equal(t0) {
+		t.Errorf("%d calls, clock moved by %v", calls, clock.Now().Sub(t0))
+	}
+}
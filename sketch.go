@@ -0,0 +1,189 @@
+package ledge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultSketchAccuracy is the relative accuracy of sketches made by
+// WithSketch.
+const DefaultSketchAccuracy = 0.01
+
+// Sketch is a mergeable quantile sketch in the style of DDSketch: every
+// percentile it reports is within its relative accuracy of a true sample
+// value. Sketches from different hosts can be serialized with MarshalBinary,
+// combined with Merge, and queried for global percentiles. Values at or below
+// zero are kept in a single zero bucket. A Sketch is not safe for concurrent
+// use.
+type Sketch struct {
+	accuracy float64
+	gamma    float64
+	buckets  map[int32]uint64
+	zeros    uint64
+	count    uint64
+}
+
+// NewSketch returns an empty Sketch. It panics if relativeAccuracy is not in
+// (0,1).
+func NewSketch(relativeAccuracy float64) *Sketch {
+	if !validAccuracy(relativeAccuracy) {
+		panic(fmt.Sprintf("ledge: sketch accuracy %v not in (0,1)", relativeAccuracy))
+	}
+	return &Sketch{
+		accuracy: relativeAccuracy,
+		gamma:    (1 + relativeAccuracy) / (1 - relativeAccuracy),
+		buckets:  make(map[int32]uint64),
+	}
+}
+
+func (s *Sketch) Add(v float64) {
+	s.count++
+	if v <= 0 || math.IsNaN(v) {
+		s.zeros++
+		return
+	}
+	s.buckets[int32(math.Ceil(math.Log(v)/math.Log(s.gamma)))]++
+}
+
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+func (s *Sketch) RelativeAccuracy() float64 {
+	return s.accuracy
+}
+
+// Percentile returns the estimated perc-th percentile, perc in (0,100], or
+// false if the sketch is empty or perc is out of range.
+func (s *Sketch) Percentile(perc float64) (float64, bool) {
+	if s.count == 0 || !(perc > 0 && perc <= 100) {
+		return 0, false
+	}
+	rank := uint64(math.Ceil(float64(s.count) * perc / 100))
+	seen := s.zeros
+	if seen >= rank {
+		return 0, true
+	}
+	indexes := make([]int, 0, len(s.buckets))
+	for i := range s.buckets {
+		indexes = append(indexes, int(i))
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		seen += s.buckets[int32(i)]
+		if seen >= rank {
+			return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1), true
+		}
+	}
+	return 0, false
+}
+
+// Merge adds all of other's samples to s. Both must have the same relative
+// accuracy.
+func (s *Sketch) Merge(other *Sketch) error {
+	if other.accuracy != s.accuracy {
+		return fmt.Errorf("cannot merge sketches of accuracy %v and %v", s.accuracy, other.accuracy)
+	}
+	for i, n := range other.buckets {
+		s.buckets[i] += n
+	}
+	s.zeros += other.zeros
+	s.count += other.count
+	return nil
+}
+
+func validAccuracy(a float64) bool {
+	return a > 0 && a < 1
+}
+
+func (s *Sketch) copy() *Sketch {
+	c := NewSketch(s.accuracy)
+	c.Merge(s)
+	return c
+}
+
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	scratch := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v uint64) {
+		buf.Write(scratch[:binary.PutUvarint(scratch, v)])
+	}
+	putUvarint(math.Float64bits(s.accuracy))
+	putUvarint(s.zeros)
+	putUvarint(uint64(len(s.buckets)))
+	for i, n := range s.buckets {
+		buf.Write(scratch[:binary.PutVarint(scratch, int64(i))])
+		putUvarint(n)
+	}
+	return buf.Bytes(), nil
+}
+
+var errSketchEncoding = errors.New("ledge: malformed sketch encoding")
+
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	accuracy, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errSketchEncoding
+	}
+	zeros, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errSketchEncoding
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errSketchEncoding
+	}
+	if !validAccuracy(math.Float64frombits(accuracy)) {
+		return errSketchEncoding
+	}
+	decoded := NewSketch(math.Float64frombits(accuracy))
+	decoded.zeros = zeros
+	decoded.count = zeros
+	for ; n > 0; n-- {
+		i, err := binary.ReadVarint(r)
+		if err != nil || i < math.MinInt32 || i > math.MaxInt32 {
+			return errSketchEncoding
+		}
+		c, err := binary.ReadUvarint(r)
+		if err != nil {
+			return errSketchEncoding
+		}
+		decoded.buckets[int32(i)] += c
+		decoded.count += c
+	}
+	if r.Len() != 0 {
+		return errSketchEncoding
+	}
+	*s = *decoded
+	return nil
+}
+
+// WithSketch additionally feeds every sample recorded into tag to a Sketch
+// of DefaultSketchAccuracy, retrievable with Sketch. tag is normalized like
+// recorded tags, so set any WithTagNormalizer first. Call it before l is
+// shared.
+func (l *Ledge) WithSketch(tag string) *Ledge {
+	tag = l.normalize(tag)
+	l.recordsLock.Lock()
+	defer l.recordsLock.Unlock()
+	l.sketches[tag] = NewSketch(DefaultSketchAccuracy)
+	return l
+}
+
+// Sketch returns a copy of tag's sketch, or false if WithSketch was not used
+// for tag.
+func (l *Ledge) Sketch(tag string) (*Sketch, bool) {
+	tag = l.normalize(tag)
+	l.recordsLock.RLock()
+	defer l.recordsLock.RUnlock()
+	s, ok := l.sketches[tag]
+	if !ok {
+		return nil, false
+	}
+	return s.copy(), true
+}
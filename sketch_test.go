@@ -0,0 +1,121 @@
+package ledge
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSketchMergeAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var all []float64
+	merged := NewSketch(DefaultSketchAccuracy)
+	for host := 0; host < 5; host++ {
+		s := NewSketch(DefaultSketchAccuracy)
+		for i := 0; i < 2000; i++ {
+			v := r.ExpFloat64() * float64(10*(host+1))
+			s.Add(v)
+			all = append(all, v)
+		}
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Sketch
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := merged.Merge(&decoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if merged.Count() != uint64(len(all)) {
+		t.Fatalf("merged count %d, want %d", merged.Count(), len(all))
+	}
+	sort.Float64s(all)
+	for _, p := range []float64{50, 90, 99, 99.9} {
+		exact := percentileSorted(all, p)
+		got, ok := merged.Percentile(p)
+		if !ok || math.Abs(got-exact) > exact*merged.RelativeAccuracy() {
+			t.Errorf("p%v = %v, exact %v, beyond %v relative error", p, got, exact, merged.RelativeAccuracy())
+		}
+	}
+}
+
+func TestSketchZerosAndRange(t *testing.T) {
+	s := NewSketch(0.02)
+	if _, ok := s.Percentile(50); ok {
+		t.Error("empty sketch reported a percentile")
+	}
+	s.Add(0)
+	s.Add(-3)
+	s.Add(10)
+	if got, ok := s.Percentile(50); !ok || got != 0 {
+		t.Errorf("p50 = %v, %v, want 0", got, ok)
+	}
+	if got, _ := s.Percentile(100); math.Abs(got-10) > 10*0.02 {
+		t.Errorf("p100 = %v, want about 10", got)
+	}
+	for _, p := range []float64{0, 101} {
+		if _, ok := s.Percentile(p); ok {
+			t.Errorf("Percentile(%v) reported ok", p)
+		}
+	}
+}
+
+func TestSketchMergeAccuracyMismatch(t *testing.T) {
+	if err := NewSketch(0.01).Merge(NewSketch(0.02)); err == nil {
+		t.Error("merged sketches of different accuracy")
+	}
+}
+
+func TestNewSketchInvalidAccuracy(t *testing.T) {
+	for _, a := range []float64{0, 1, -0.5, math.NaN()} {
+		mustPanic(t, func() { NewSketch(a) })
+	}
+}
+
+func TestSketchUnmarshalInvalid(t *testing.T) {
+	good, _ := NewSketch(0.01).MarshalBinary()
+	accuracy := func(a float64) []byte {
+		b := make([]byte, binary.MaxVarintLen64)
+		return append(b[:binary.PutUvarint(b, math.Float64bits(a))], 0, 0)
+	}
+	for name, data := range map[string][]byte{
+		"empty":         nil,
+		"truncated":     good[:len(good)-1],
+		"trailing":      append(append([]byte(nil), good...), 0),
+		"zero accuracy": accuracy(0),
+		"accuracy 1":    accuracy(1),
+		"NaN accuracy":  accuracy(math.NaN()),
+	} {
+		var s Sketch
+		if err := s.UnmarshalBinary(data); err != errSketchEncoding {
+			t.Errorf("%s: err = %v, want errSketchEncoding", name, err)
+		}
+	}
+}
+
+func TestWithSketch(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithTagNormalizer(strings.ToLower).WithSketch("API")
+	l.RecordBatch("Api", []float64{1, 2, 3})
+	s, ok := l.Sketch("api")
+	if !ok || s.Count() != 3 {
+		t.Fatalf("Sketch = %v, %v, want the 3 normalized samples", s, ok)
+	}
+	s.Add(4)
+	if again, _ := l.Sketch("api"); again.Count() != 3 {
+		t.Error("Sketch did not return a copy")
+	}
+	if _, ok := l.Sketch("other"); ok {
+		t.Error("Sketch of a tag without WithSketch reported ok")
+	}
+	l.ClearRecords("api")
+	if s, _ := l.Sketch("api"); s.Count() != 0 {
+		t.Errorf("sketch kept %d samples after ClearRecords", s.Count())
+	}
+}
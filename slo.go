@@ -0,0 +1,70 @@
+package ledge
+
+import (
+	"time"
+)
+
+// sloCounts are the outcomes recorded into a tag with RecordSLO.
+type sloCounts struct {
+	successes int
+	failures  int
+}
+
+// SLOResult reports a tag's latency and availability against its objectives.
+type SLOResult struct {
+	LatencyPercentile float64
+	Latency           float64
+	LatencyThreshold  float64
+	LatencyOK         bool
+	Successes         int
+	Failures          int
+	Availability      float64
+}
+
+// RecordSLO records d into tag and counts the request as a success or
+// failure, so that SLOReport can judge latency and availability together.
+// If d is rejected, for example because tag holds value samples, the outcome
+// is not counted either.
+func (l *Ledge) RecordSLO(tag string, d time.Duration, ok bool) {
+	if l == nil {
+		return
+	}
+	if l.stats.IsSet() {
+		if !l.recordElapsed(tag, d) {
+			return
+		}
+		tag = l.normalize(tag)
+		l.recordsLock.Lock()
+		defer l.recordsLock.Unlock()
+		counts, found := l.slo[tag]
+		if !found {
+			counts = &sloCounts{}
+			l.slo[tag] = counts
+		}
+		if ok {
+			counts.successes++
+		} else {
+			counts.failures++
+		}
+	}
+}
+
+// SLOReport computes tag's latencyP percentile latency (in milliseconds)
+// against latencyThreshold, and the fraction of RecordSLO requests that
+// succeeded.
+func (l *Ledge) SLOReport(tag string, latencyP float64, latencyThreshold float64) SLOResult {
+	r := SLOResult{LatencyPercentile: latencyP, LatencyThreshold: latencyThreshold}
+	if sorted := l.sortedSamples(tag); len(sorted) > 0 && latencyP > 0 && latencyP <= 100 {
+		r.Latency = percentileSorted(sorted, latencyP)
+		r.LatencyOK = r.Latency <= latencyThreshold
+	}
+	l.recordsLock.RLock()
+	if counts, ok := l.slo[tag]; ok {
+		r.Successes, r.Failures = counts.successes, counts.failures
+	}
+	l.recordsLock.RUnlock()
+	if total := r.Successes + r.Failures; total > 0 {
+		r.Availability = float64(r.Successes) / float64(total)
+	}
+	return r
+}
@@ -0,0 +1,67 @@
+package ledge
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSLOReport(t *testing.T) {
+	l, _, _ := newTestLedge()
+	for i := 1; i <= 10; i++ {
+		l.RecordSLO("api", time.Duration(i)*10*time.Millisecond, i != 4)
+	}
+	r := l.SLOReport("api", 90, 95)
+	want := SLOResult{
+		LatencyPercentile: 90,
+		Latency:           90,
+		LatencyThreshold:  95,
+		LatencyOK:         true,
+		Successes:         9,
+		Failures:          1,
+		Availability:      0.9,
+	}
+	if r != want {
+		t.Errorf("SLOReport = %+v, want %+v", r, want)
+	}
+	if r := l.SLOReport("api", 99, 95); r.Latency != 100 || r.LatencyOK {
+		t.Errorf("p99 report %+v, want latency 100 over the threshold", r)
+	}
+}
+
+func TestSLOReportNormalizesTags(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordSLO("API", time.Millisecond, false)
+	l.WithTagNormalizer(strings.ToLower).NormalizeExistingTags()
+	l.RecordSLO("Api", time.Millisecond, true)
+	if r := l.SLOReport("api", 50, 1); r.Successes != 1 || r.Failures != 1 || r.Availability != 0.5 {
+		t.Errorf("report after normalizing %+v, want both outcomes merged", r)
+	}
+}
+
+func TestRecordSLORejectedLatency(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordValue("api", 5)
+	l.RecordSLO("api", time.Millisecond, false)
+	if r := l.SLOReport("api", 50, 10); r.Successes+r.Failures != 0 {
+		t.Errorf("counted an outcome whose latency was rejected: %+v", r)
+	}
+	l.WithMaxPlausible(time.Second, true)
+	l.RecordSLO("dropped", time.Hour, true)
+	if r := l.SLOReport("dropped", 50, 10); r.Successes+r.Failures != 0 {
+		t.Errorf("counted an outcome whose latency was dropped: %+v", r)
+	}
+}
+
+func TestSLOReportEmpty(t *testing.T) {
+	l, _, _ := newTestLedge()
+	r := l.SLOReport("absent", 99, 10)
+	if r.LatencyOK || r.Availability != 0 || r.Successes+r.Failures != 0 {
+		t.Errorf("report without samples %+v", r)
+	}
+	l.StatsOff()
+	l.RecordSLO("off", time.Second, true)
+	if r := l.SLOReport("off", 99, 10); r.Successes != 0 || r.Latency != 0 {
+		t.Errorf("recorded with stats off: %+v", r)
+	}
+}
@@ -0,0 +1,55 @@
+package ledge
+
+import (
+	"math"
+	"sort"
+)
+
+// sortedSamples returns tag's samples in ascending order. The sorted copy is
+// cached until tag's records next change, so back-to-back percentile queries
+// sort only once; tags without samples are not cached. The cache is not
+// counted against WithMemoryBudget. The result is shared and must not be
+// modified.
+func (l *Ledge) sortedSamples(tag string) []float64 {
+	l.recordsLock.RLock()
+	sorted, ok := l.sorted[tag]
+	empty := len(l.records[tag]) == 0
+	l.recordsLock.RUnlock()
+	if ok {
+		return sorted
+	}
+	if empty {
+		return nil
+	}
+	l.recordsLock.Lock()
+	defer l.recordsLock.Unlock()
+	if sorted, ok := l.sorted[tag]; ok {
+		return sorted
+	}
+	if len(l.records[tag]) == 0 {
+		return nil
+	}
+	sorted = append([]float64(nil), l.records[tag]...)
+	sort.Float64s(sorted)
+	l.sorted[tag] = sorted
+	return sorted
+}
+
+// percentileSorted is stats.PercentileNearestRank over already sorted,
+// non-empty samples with perc in (0,100].
+func percentileSorted(sorted []float64, perc float64) float64 {
+	rank := int(math.Ceil(float64(len(sorted)) * perc / 100))
+	if rank == 0 {
+		return sorted[0]
+	}
+	return sorted[rank-1]
+}
+
+// medianSorted is stats.Median over already sorted, non-empty samples.
+func medianSorted(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[n/2]
+}
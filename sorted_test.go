@@ -0,0 +1,99 @@
+package ledge
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/montanaflynn/stats"
+)
+
+func TestSortedSamplesCache(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("op", []float64{5, 1, 3})
+	sorted := l.sortedSamples("op")
+	if !equalFloats(sorted, []float64{1, 3, 5}) {
+		t.Fatalf("sorted = %v", sorted)
+	}
+	if again := l.sortedSamples("op"); &again[0] != &sorted[0] {
+		t.Error("second query sorted again instead of using the cache")
+	}
+	l.RecordBatch("op", []float64{0, 10})
+	if got := l.sortedSamples("op"); !equalFloats(got, []float64{0, 1, 3, 5, 10}) {
+		t.Errorf("sorted after recording = %v, want the cache invalidated", got)
+	}
+	if s, _ := l.Summary("op"); s.Min != 0 || s.Max != 10 || s.Median != 3 {
+		t.Errorf("summary after recording %+v", s)
+	}
+	l.ClearRecords("op")
+	if got := l.sortedSamples("op"); len(got) != 0 {
+		t.Errorf("sorted after clearing = %v", got)
+	}
+}
+
+func TestSortedSamplesEmptyNotCached(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.sortedSamples("absent")
+	l.Stats("absent")
+	l.Perc("absent", 50)
+	if len(l.sorted) != 0 {
+		t.Errorf("cached %v for a tag without samples", l.sorted)
+	}
+}
+
+func TestSortedSamplesConcurrent(t *testing.T) {
+	l, _, _ := newTestLedge()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				l.RecordValue("op", float64(w*1000+i))
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if sorted := l.sortedSamples("op"); !sort.Float64sAreSorted(sorted) {
+					t.Error("cached samples are not sorted")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	s, _ := l.Summary("op")
+	want, _ := stats.PercentileNearestRank(l.samples("op"), 99)
+	if s.Count != 800 || s.P99 != want {
+		t.Errorf("summary after concurrent records %+v, want count 800 and p99 %v", s, want)
+	}
+}
+
+func benchmarkPercentiles(b *testing.B, cached bool) {
+	l, _, _ := newTestLedge()
+	r := rand.New(rand.NewSource(1))
+	values := make([]float64, 100000)
+	for i := range values {
+		values[i] = r.Float64()
+	}
+	l.RecordBatch("op", values)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !cached {
+			l.recordsLock.Lock()
+			delete(l.sorted, "op")
+			l.recordsLock.Unlock()
+		}
+		l.summary("op")
+	}
+}
+
+func BenchmarkPercentilesCached(b *testing.B) {
+	benchmarkPercentiles(b, true)
+}
+
+func BenchmarkPercentilesUncached(b *testing.B) {
+	benchmarkPercentiles(b, false)
+}
@@ -0,0 +1,90 @@
+package ledge
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/montanaflynn/stats"
+)
+
+// RecordFrom is Record, additionally attributing the sample to who (for
+// example a worker or goroutine name) so StatsBy can break tag down by source.
+func (l *Ledge) RecordFrom(tag, who string, f func()) {
+	if l == nil {
+		f()
+		return
+	}
+	defer l.enter(tag).exit()
+	t0 := time.Now()
+	f()
+	if l.stats.IsSet() {
+		tag = l.normalize(tag)
+		elapsed := time.Since(t0)
+		if !l.recordElapsed(tag, elapsed) {
+			return
+		}
+		l.recordsLock.Lock()
+		defer l.recordsLock.Unlock()
+		if l.sources[tag] == nil {
+			l.sources[tag] = make(map[string][]float64)
+		}
+		l.sources[tag][who] = append(l.sources[tag][who], toMillis(elapsed))
+	}
+}
+
+// StatsBy prints the count and mean of tag's samples per source recorded with
+// RecordFrom.
+func (l *Ledge) StatsBy(tag string) {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		l.recordsLock.RLock()
+		bySource := make(map[string][]float64, len(l.sources[tag]))
+		for who, records := range l.sources[tag] {
+			bySource[who] = append([]float64(nil), records...)
+		}
+		l.recordsLock.RUnlock()
+		sources := make([]string, 0, len(bySource))
+		for who := range bySource {
+			sources = append(sources, who)
+		}
+		sort.Strings(sources)
+		for _, who := range sources {
+			records := bySource[who]
+			mean, _ := stats.Mean(records)
+			tagString := fmt.Sprintf("[BY %s %s]", tag, who)
+			l.emitStat(tagString, fmt.Sprintf("count %d mean %f", len(records), mean))
+		}
+	}
+}
+
+// RecordByError times f and records the duration into baseTag, and, if f
+// fails, also into baseTag:<type> where type is the error's concrete type,
+// such as baseTag:os.PathError. f's error is returned.
+func (l *Ledge) RecordByError(baseTag string, f func() error) error {
+	if l == nil {
+		return f()
+	}
+	defer l.enter(baseTag).exit()
+	t0 := time.Now()
+	err := f()
+	if l.stats.IsSet() {
+		elapsed := time.Since(t0)
+		l.recordElapsed(baseTag, elapsed)
+		if err != nil {
+			l.recordElapsed(baseTag+":"+errorTypeName(err), elapsed)
+		}
+	}
+	return err
+}
+
+func errorTypeName(err error) string {
+	t := reflect.TypeOf(err)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.String()
+}
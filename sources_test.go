@@ -0,0 +1,82 @@
+package ledge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecordFromStatsBy(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	for i := 0; i < 3; i++ {
+		l.RecordFrom("work", "worker-b", func() {})
+	}
+	l.RecordFrom("work", "worker-a", func() {})
+	l.RecordFrom("work", "worker-c", func() {})
+	l.RecordFrom("work", "worker-c", func() {})
+	if l.count("work") != 6 {
+		t.Errorf("tag holds %d samples, want all 6", l.count("work"))
+	}
+	l.StatsBy("work")
+	got := lines(stdout)
+	want := []string{"[BY work worker-a] count 1 mean ", "[BY work worker-b] count 3 mean ", "[BY work worker-c] count 2 mean "}
+	if len(got) != len(want) {
+		t.Fatalf("StatsBy printed %q", got)
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("line %q lacks %q", got[i], want[i])
+		}
+	}
+}
+
+func TestStatsByWithoutSources(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.Record("plain", func() {})
+	l.StatsBy("plain")
+	if stdout.Len() != 0 {
+		t.Errorf("StatsBy printed %q for a tag without sources", stdout.String())
+	}
+}
+
+type timeoutError struct{}
+
+func (*timeoutError) Error() string { return "timeout" }
+
+type refusedError struct{}
+
+func (refusedError) Error() string { return "refused" }
+
+func TestRecordByError(t *testing.T) {
+	l, _, _ := newTestLedge()
+	results := []error{nil, refusedError{}, &timeoutError{}, &timeoutError{}, nil}
+	for _, want := range results {
+		if got := l.RecordByError("op", func() error { return want }); got != want {
+			t.Errorf("RecordByError returned %v, want %v", got, want)
+		}
+	}
+	for tag, want := range map[string]int{
+		"op":                    5,
+		"op:ledge.refusedError": 1,
+		"op:ledge.timeoutError": 2,
+	} {
+		if got := l.count(tag); got != want {
+			t.Errorf("%s holds %d samples, want %d", tag, got, want)
+		}
+	}
+	if tags := l.tags(); len(tags) != 3 {
+		t.Errorf("tags = %q, want only the base and per-type tags", tags)
+	}
+}
+
+func TestRecordByErrorStatsOff(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.StatsOff()
+	wantErr := errors.New("bad")
+	if err := l.RecordByError("op", func() error { return wantErr }); err != wantErr {
+		t.Errorf("returned %v", err)
+	}
+	if len(l.tags()) != 0 {
+		t.Errorf("recorded %q with stats off", l.tags())
+	}
+}
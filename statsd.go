@@ -0,0 +1,115 @@
+package ledge
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsdPacketSize keeps StatsD datagrams under a typical Ethernet MTU.
+const statsdPacketSize = 1432
+
+// WithStatsD ships timing samples to the StatsD server at addr (host:port)
+// over UDP every flushInterval: each sample as a tag:value|ms timer and each
+// tag's sample count as a tag.count:n|c counter. Shipped samples are removed
+// from l. Tags are rewritten to the StatsD character set and send failures
+// are logged as debug lines. Close stops shipping after a final flush; with a
+// flushInterval of zero or less, that is the only flush. Call it before l is
+// shared.
+func (l *Ledge) WithStatsD(addr string, flushInterval time.Duration) *Ledge {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		l.Errorf("statsd: %v", err)
+		return l
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var tick <-chan time.Time
+		if flushInterval > 0 {
+			ticker := time.NewTicker(flushInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-tick:
+				l.shipStatsD(conn)
+			case <-stop:
+				l.shipStatsD(conn)
+				return
+			}
+		}
+	}()
+	l.stoppers = append(l.stoppers, func() error {
+		close(stop)
+		<-done
+		return conn.Close()
+	})
+	return l
+}
+
+// shipStatsD sends and removes all timing samples.
+func (l *Ledge) shipStatsD(conn net.Conn) {
+	var packet strings.Builder
+	send := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := conn.Write([]byte(packet.String())); err != nil {
+			l.Debugf("statsd: %v", err)
+		}
+		packet.Reset()
+	}
+	add := func(metric string) {
+		if packet.Len() > 0 && packet.Len()+1+len(metric) > statsdPacketSize {
+			send()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(metric)
+	}
+	drained := l.drain(kindDuration)
+	for _, tag := range sortedKeys(drained) {
+		name := statsdName(tag)
+		for _, v := range drained[tag] {
+			add(name + ":" + strconv.FormatFloat(v, 'f', -1, 64) + "|ms")
+		}
+		add(fmt.Sprintf("%s.count:%d|c", name, len(drained[tag])))
+	}
+	send()
+}
+
+// drain removes and returns the samples of all tags of kind k.
+func (l *Ledge) drain(k kind) map[string][]float64 {
+	l.recordsLock.Lock()
+	defer l.recordsLock.Unlock()
+	drained := make(map[string][]float64)
+	for tag, records := range l.records {
+		if len(records) == 0 || l.kinds[tag] != k {
+			continue
+		}
+		drained[tag] = records
+		l.unaccount(tag)
+		l.records[tag] = make([]float64, 0)
+		delete(l.sorted, tag)
+		delete(l.stamps, tag)
+		delete(l.deltaCursors, tag)
+	}
+	return drained
+}
+
+// statsdName replaces characters that are not valid in a StatsD metric name.
+func statsdName(tag string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, tag)
+}
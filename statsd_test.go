@@ -0,0 +1,119 @@
+package ledge
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no UDP listener: %v", err)
+	}
+	defer conn.Close()
+	l, _, _ := newTestLedge()
+	l.WithStatsD(conn.LocalAddr().String(), time.Hour)
+	l.RecordBatch("http get", []float64{1.5, 2})
+	l.RecordBatch("db", []float64{7})
+	l.RecordValue("queue", 3)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, statsdPacketSize)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(string(buf[:n]), "\n")
+	want := []string{"db:7|ms", "db.count:1|c", "http_get:1.5|ms", "http_get:2|ms", "http_get.count:2|c"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("packet %q, want %q", got, want)
+	}
+	if l.count("http get") != 0 || l.count("db") != 0 {
+		t.Error("shipped samples were kept")
+	}
+	if l.count("queue") != 1 {
+		t.Error("value samples were shipped as timers")
+	}
+}
+
+func TestWithStatsDNoInterval(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no UDP listener: %v", err)
+	}
+	defer conn.Close()
+	l, _, _ := newTestLedge()
+	l.WithStatsD(conn.LocalAddr().String(), 0)
+	l.RecordBatch("op", []float64{1})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, statsdPacketSize)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "op:1|ms\nop.count:1|c" {
+		t.Errorf("packet %q", got)
+	}
+}
+
+func TestStatsDPacketSize(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no UDP listener: %v", err)
+	}
+	defer conn.Close()
+	l, _, _ := newTestLedge()
+	l.WithStatsD(conn.LocalAddr().String(), time.Hour)
+	values := make([]float64, 500)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	l.RecordBatch("op", values)
+	l.Close()
+	var metrics []string
+	buf := make([]byte, 64*1024)
+	for len(metrics) < len(values)+1 {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("after %d metrics: %v", len(metrics), err)
+		}
+		if n > statsdPacketSize {
+			t.Errorf("packet of %d bytes", n)
+		}
+		metrics = append(metrics, strings.Split(string(buf[:n]), "\n")...)
+	}
+	seen := make(map[string]bool)
+	for _, m := range metrics {
+		seen[m] = true
+	}
+	for i := range values {
+		if m := fmt.Sprintf("op:%d|ms", i); !seen[m] {
+			t.Errorf("%s not sent", m)
+		}
+	}
+	if !seen["op.count:500|c"] {
+		t.Error("count not sent")
+	}
+}
+
+func TestStatsDName(t *testing.T) {
+	for tag, want := range map[string]string{
+		"http.get":  "http.get",
+		"a b:c|d@e": "a_b_c_d_e",
+		"ok_tag-1":  "ok_tag-1",
+		"größe":     "gr__e",
+	} {
+		if got := statsdName(tag); got != want {
+			t.Errorf("statsdName(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
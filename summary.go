@@ -0,0 +1,402 @@
+package ledge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/logrusorgru/aurora/v3"
+	"github.com/montanaflynn/stats"
+)
+
+// StatsSummary holds the statistics that Stats prints for a set of samples.
+type StatsSummary struct {
+	Count    int
+	Min      float64
+	Median   float64
+	P99      float64
+	Max      float64
+	Mean     float64
+	Variance float64
+}
+
+// summarize computes a StatsSummary over records. An empty slice yields the
+// zero summary.
+func summarize(records []float64) StatsSummary {
+	sorted := append([]float64(nil), records...)
+	sort.Float64s(sorted)
+	return summarizeSorted(sorted)
+}
+
+// summarizeSorted is summarize over samples that are already sorted.
+func summarizeSorted(sorted []float64) StatsSummary {
+	if len(sorted) == 0 {
+		return StatsSummary{}
+	}
+	s := StatsSummary{Count: len(sorted)}
+	s.Min = sorted[0]
+	s.Median = medianSorted(sorted)
+	s.P99 = percentileSorted(sorted, 99)
+	s.Max = sorted[len(sorted)-1]
+	s.Mean, _ = stats.Mean(sorted)
+	s.Variance, _ = stats.Variance(sorted)
+	return s
+}
+
+// Marker is a checkpoint in a tag's records, returned by Mark.
+type Marker struct {
+	tag   string
+	count int
+	sum   float64
+}
+
+// Mark checkpoints tag so that Since can later summarize only the samples
+// recorded after this call.
+func (l *Ledge) Mark(tag string) Marker {
+	records := l.samples(tag)
+	sum, _ := stats.Sum(records)
+	return Marker{tag: tag, count: len(records), sum: sum}
+}
+
+// Since summarizes the samples recorded into the marker's tag after Mark was
+// called. If the tag has been cleared since, all of its current samples are
+// used.
+func (l *Ledge) Since(m Marker) StatsSummary {
+	records := l.samples(m.tag)
+	if len(records) < m.count {
+		return summarize(records)
+	}
+	if sum, _ := stats.Sum(records[:m.count]); sum != m.sum {
+		return summarize(records)
+	}
+	return summarize(records[m.count:])
+}
+
+// Summary returns the StatsSummary of tag's samples, or false if it has none.
+func (l *Ledge) Summary(tag string) (StatsSummary, bool) {
+	s, ok := l.summary(tag)
+	if ok {
+		l.statsReported(tag, s)
+	}
+	return s, ok
+}
+
+// summary is Summary without notifying OnStats callbacks, for internal use.
+func (l *Ledge) summary(tag string) (StatsSummary, bool) {
+	sorted := l.sortedSamples(tag)
+	if len(sorted) == 0 {
+		return StatsSummary{}, false
+	}
+	return summarizeSorted(sorted), true
+}
+
+// OnStats registers f to be called with tag's summary whenever Stats,
+// StatsLine or Summary is invoked for a tag with samples, e.g. to forward
+// summaries to a metrics system. f runs with no locks held. Call it before l
+// is shared.
+func (l *Ledge) OnStats(f func(tag string, summary StatsSummary)) *Ledge {
+	l.statsHooks = append(l.statsHooks, f)
+	return l
+}
+
+func (l *Ledge) statsReported(tag string, s StatsSummary) {
+	for _, hook := range l.statsHooks {
+		hook(tag, s)
+	}
+}
+
+// WithAutoSummary makes l print StatsLine for a tag after every every samples
+// recorded into it, for quick profiling without a reporting loop. Call it
+// before l is shared.
+func (l *Ledge) WithAutoSummary(every int) *Ledge {
+	l.autoSummary = every
+	l.autoCounts = make(map[string]int)
+	return l
+}
+
+// StatsLine prints tag's summary as a single line.
+func (l *Ledge) StatsLine(tag string) {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		tagString := fmt.Sprintf("[STATS %s]", tag)
+		s, ok := l.summary(tag)
+		if !ok {
+			l.emitStat(tagString, "no samples")
+			return
+		}
+		l.emitStat(tagString, summaryFields(s))
+		l.statsReported(tag, s)
+	}
+}
+
+// Snapshot returns the summary of every tag that has samples, e.g. to keep as
+// a baseline for PrintCompare.
+func (l *Ledge) Snapshot() map[string]StatsSummary {
+	snapshot := make(map[string]StatsSummary)
+	for _, tag := range l.tags() {
+		if s, ok := l.summary(tag); ok {
+			snapshot[tag] = s
+		}
+	}
+	return snapshot
+}
+
+// tags returns the sorted names of all recorded tags.
+func (l *Ledge) tags() []string {
+	l.recordsLock.RLock()
+	defer l.recordsLock.RUnlock()
+	return sortedKeys(l.records)
+}
+
+func sortedKeys(m map[string][]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PrintCompare prints, per tag, how candidate's mean and p99 changed relative
+// to baseline. Improvements are green, regressions red and unchanged values
+// uncolored; with color off the trailing "improved", "regressed" or
+// "unchanged" word carries the same information.
+func (l *Ledge) PrintCompare(baseline, candidate map[string]StatsSummary) {
+	if l == nil {
+		return
+	}
+	seen := make(map[string]bool)
+	var tags []string
+	for _, m := range []map[string]StatsSummary{baseline, candidate} {
+		for tag := range m {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		tagString := fmt.Sprintf("[COMPARE %s]", tag)
+		base, inBase := baseline[tag]
+		cand, inCand := candidate[tag]
+		if !inBase || !inCand {
+			where := "baseline"
+			if inCand {
+				where = "candidate"
+			}
+			l.emitStat(tagString, "only in "+where)
+			continue
+		}
+		verdict := Green("improved")
+		switch {
+		case cand.Mean > base.Mean:
+			verdict = Red("regressed")
+		case cand.Mean == base.Mean:
+			verdict = Reset("unchanged")
+		}
+		l.emitStat(tagString, fmt.Sprintf("mean %f -> %f %s p99 %f -> %f %s %s",
+			base.Mean, cand.Mean, l.colorize(delta(base.Mean, cand.Mean)),
+			base.P99, cand.P99, l.colorize(delta(base.P99, cand.P99)),
+			l.colorize(verdict)))
+	}
+}
+
+// delta renders the percent change from base to cand, green when it shrank,
+// red when it grew and uncolored when it did not change.
+func delta(base, cand float64) Value {
+	if base == 0 {
+		return Yellow("(n/a)")
+	}
+	pct := (cand - base) / base * 100
+	s := fmt.Sprintf("(%+.1f%%)", pct)
+	switch {
+	case pct > 0:
+		return Red(s)
+	case pct == 0:
+		return Reset(s)
+	}
+	return Green(s)
+}
+
+// PercentileAcrossTags computes the innerPercentile of each of tags and then
+// the outerPercentile of those values, e.g. the p99 of per-host medians. Tags
+// without samples are skipped; false is returned if none have any.
+func (l *Ledge) PercentileAcrossTags(tags []string, innerPercentile, outerPercentile float64) (float64, bool) {
+	var inner []float64
+	for _, tag := range tags {
+		records := l.samples(tag)
+		if len(records) == 0 {
+			continue
+		}
+		p, err := stats.PercentileNearestRank(records, innerPercentile)
+		if err != nil {
+			return 0, false
+		}
+		inner = append(inner, p)
+	}
+	if len(inner) == 0 {
+		return 0, false
+	}
+	p, err := stats.PercentileNearestRank(inner, outerPercentile)
+	if err != nil {
+		return 0, false
+	}
+	return p, true
+}
+
+// formatSummary renders s as a single plain-text line for tag.
+func formatSummary(tag string, s StatsSummary) string {
+	return fmt.Sprintf("[STATS %s] %s", tag, summaryFields(s))
+}
+
+func summaryFields(s StatsSummary) string {
+	return fmt.Sprintf("count %d min %f median %f p99 %f max %f mean %f variance %f",
+		s.Count, s.Min, s.Median, s.P99, s.Max, s.Mean, s.Variance)
+}
+
+// StatsAll prints Stats for every recorded tag.
+func (l *Ledge) StatsAll() {
+	if l == nil {
+		return
+	}
+	for _, tag := range l.tags() {
+		l.Stats(tag)
+	}
+}
+
+// StatsAllContext writes a one-line summary of every tag with samples to w,
+// stopping with ctx.Err() between tags once ctx is done. Lines written before
+// cancellation are kept.
+func (l *Ledge) StatsAllContext(ctx context.Context, w io.Writer) error {
+	if l == nil {
+		return nil
+	}
+	for _, tag := range l.tags() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s, ok := l.summary(tag)
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, formatSummary(tag, s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SummaryUnion summarizes the samples of all of tags together, without
+// merging them, or returns false if none have samples.
+func (l *Ledge) SummaryUnion(tags ...string) (StatsSummary, bool) {
+	var records []float64
+	for _, tag := range tags {
+		records = append(records, l.samples(tag)...)
+	}
+	if len(records) == 0 {
+		return StatsSummary{}, false
+	}
+	return summarize(records), true
+}
+
+// StatsUnion prints SummaryUnion of tags as one line labelled with the tags
+// joined by "+".
+func (l *Ledge) StatsUnion(tags ...string) {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		tagString := fmt.Sprintf("[UNION %s]", strings.Join(tags, "+"))
+		s, ok := l.SummaryUnion(tags...)
+		if !ok {
+			l.emitStat(tagString, "no samples")
+			return
+		}
+		l.emitStat(tagString, summaryFields(s))
+	}
+}
+
+// SummaryDelta summarizes the samples recorded into tag since the previous
+// SummaryDelta or StatsDelta call for tag, and moves the cursor to the end.
+// If tag has shrunk since (for example by ClearRecords), all of its samples
+// count as new. It returns false if there are no new samples.
+func (l *Ledge) SummaryDelta(tag string) (StatsSummary, bool) {
+	l.recordsLock.Lock()
+	records := l.records[tag]
+	from := l.deltaCursors[tag]
+	if from > len(records) {
+		from = 0
+	}
+	fresh := append([]float64(nil), records[from:]...)
+	l.deltaCursors[tag] = len(records)
+	l.recordsLock.Unlock()
+	if len(fresh) == 0 {
+		return StatsSummary{}, false
+	}
+	return summarize(fresh), true
+}
+
+// StatsDelta prints SummaryDelta of tag as a single line.
+func (l *Ledge) StatsDelta(tag string) {
+	if l == nil {
+		return
+	}
+	if l.reporting.IsSet() {
+		tagString := fmt.Sprintf("[DELTA %s]", tag)
+		s, ok := l.SummaryDelta(tag)
+		if !ok {
+			l.emitStat(tagString, "no new samples")
+			return
+		}
+		l.emitStat(tagString, summaryFields(s))
+	}
+}
+
+// StartIntervalReport calls report every interval with the SummaryDelta of
+// each tag that received samples since the previous tick, for metrics systems
+// that expect fixed-interval rollups. It shares its cursors with SummaryDelta
+// and StatsDelta. The returned stop function ends reporting and waits for any
+// report in progress; it may be called more than once. An interval of zero or
+// less is logged as an error and nothing is reported.
+func (l *Ledge) StartIntervalReport(interval time.Duration, report func(tag string, s StatsSummary)) (stop func()) {
+	if l == nil {
+		return func() {}
+	}
+	if interval <= 0 {
+		l.Errorf("interval report: invalid interval %v", interval)
+		return func() {}
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, tag := range l.tags() {
+					if s, ok := l.SummaryDelta(tag); ok {
+						report(tag, s)
+					}
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package ledge
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkSince(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("op", []float64{100, 200, 300})
+	m := l.Mark("op")
+	if s := l.Since(m); s.Count != 0 {
+		t.Errorf("Since right after Mark = %+v, want no samples", s)
+	}
+	l.RecordBatch("op", []float64{10, 20})
+	s := l.Since(m)
+	if s.Count != 2 || s.Min != 10 || s.Max != 20 || s.Mean != 15 {
+		t.Errorf("Since = %+v, want only the two post-mark samples", s)
+	}
+	if all, _ := l.Summary("op"); all.Count != 5 {
+		t.Errorf("Mark lost the baseline: %+v", all)
+	}
+}
+
+func TestSinceAfterClear(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("op", []float64{1, 2, 3})
+	m := l.Mark("op")
+	l.ClearRecords("op")
+	l.RecordBatch("op", []float64{7})
+	if s := l.Since(m); s.Count != 1 || s.Min != 7 {
+		t.Errorf("Since after ClearRecords = %+v, want the one new sample", s)
+	}
+}
+
+func TestPrintCompareColor(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.ColorOn()
+	baseline := map[string]StatsSummary{
+		"faster": {Mean: 10, P99: 20},
+		"same":   {Mean: 10, P99: 20},
+		"slower": {Mean: 10, P99: 20},
+	}
+	candidate := map[string]StatsSummary{
+		"faster": {Mean: 5, P99: 10},
+		"same":   {Mean: 10, P99: 20},
+		"slower": {Mean: 15, P99: 30},
+	}
+	l.PrintCompare(baseline, candidate)
+	out := lines(stdout)
+	if len(out) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(out), out)
+	}
+	const green, red = "\x1b[32m", "\x1b[31m"
+	if !strings.Contains(out[0], green+"(-50.0%)") || !strings.Contains(out[0], green+"improved") {
+		t.Errorf("improved line %q lacks green deltas", out[0])
+	}
+	if !strings.HasSuffix(out[1], "mean 10.000000 -> 10.000000 (+0.0%) p99 20.000000 -> 20.000000 (+0.0%) unchanged") {
+		t.Errorf("unchanged line %q is not neutral", out[1])
+	}
+	if !strings.Contains(out[2], red+"(+50.0%)") || !strings.Contains(out[2], red+"regressed") {
+		t.Errorf("regressed line %q lacks red deltas", out[2])
+	}
+}
+
+func TestPrintComparePlain(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.PrintCompare(
+		map[string]StatsSummary{"a": {Mean: 10, P99: 10}, "b": {Mean: 5, P99: 8}, "gone": {}},
+		map[string]StatsSummary{"a": {Mean: 20, P99: 10}, "b": {Mean: 5, P99: 8}, "new": {}},
+	)
+	out := stdout.String()
+	if strings.Contains(out, "\x1b[") {
+		t.Errorf("color codes with color off: %q", out)
+	}
+	for _, want := range []string{
+		"[COMPARE a] mean 10.000000 -> 20.000000 (+100.0%) p99 10.000000 -> 10.000000 (+0.0%) regressed",
+		"[COMPARE b] mean 5.000000 -> 5.000000 (+0.0%) p99 8.000000 -> 8.000000 (+0.0%) unchanged",
+		"[COMPARE gone] only in baseline",
+		"[COMPARE new] only in candidate",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPercentileAcrossTags(t *testing.T) {
+	l, _, _ := newTestLedge()
+	hosts := map[string][]float64{
+		"host1": {1, 2, 3, 4, 5},
+		"host2": {10, 20, 30},
+		"host3": {7, 7, 8, 9},
+		"host4": {100},
+	}
+	for tag, values := range hosts {
+		l.RecordBatch(tag, values)
+	}
+	tags := []string{"host1", "host2", "host3", "host4", "empty"}
+	// Nearest-rank medians are 3, 20, 7 and 100; their nearest-rank p75 is 20.
+	if got, ok := l.PercentileAcrossTags(tags, 50, 75); !ok || got != 20 {
+		t.Errorf("p75 of medians = %v, %v, want 20", got, ok)
+	}
+	// The maxima are 5, 30, 9 and 100; their nearest-rank median is 9.
+	if got, ok := l.PercentileAcrossTags(tags, 100, 50); !ok || got != 9 {
+		t.Errorf("median of maxima = %v, %v, want 9", got, ok)
+	}
+	if _, ok := l.PercentileAcrossTags([]string{"empty"}, 50, 50); ok {
+		t.Error("ok without any samples")
+	}
+	if _, ok := l.PercentileAcrossTags(tags, 150, 50); ok {
+		t.Error("ok with an invalid inner percentile")
+	}
+}
+
+func TestStatsAllContextCancelled(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1})
+	l.RecordBatch("b", []float64{2})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var out bytes.Buffer
+	if err := l.StatsAllContext(ctx, &out); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %q after cancellation", out.String())
+	}
+}
+
+// cancelAfter cancels its context once a line has been written.
+type cancelAfter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelAfter) Write(p []byte) (int, error) {
+	defer w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func TestStatsAllContextPartial(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1})
+	l.RecordBatch("b", []float64{2})
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &cancelAfter{cancel: cancel}
+	if err := l.StatsAllContext(ctx, out); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if got := lines(&out.Buffer); len(got) != 1 || !strings.HasPrefix(got[0], "[STATS a] count 1") {
+		t.Errorf("kept %q, want only the line written before cancellation", got)
+	}
+}
+
+func TestStatsAllContext(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("a", []float64{1})
+	l.RecordBatch("b", []float64{2, 4})
+	l.ClearRecords("empty")
+	var out bytes.Buffer
+	if err := l.StatsAllContext(context.Background(), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "[STATS a] count 1 min 1.000000 median 1.000000 p99 1.000000 max 1.000000 mean 1.000000 variance 0.000000\n" +
+		"[STATS b] count 2 min 2.000000 median 3.000000 p99 4.000000 max 4.000000 mean 3.000000 variance 1.000000\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestSummaryUnion(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("read", []float64{1, 2, 3})
+	l.RecordBatch("write", []float64{10, 20})
+	s, ok := l.SummaryUnion("read", "write", "absent")
+	if !ok {
+		t.Fatal("no union summary")
+	}
+	if s.Count != 5 || s.Mean != 36.0/5 || s.Min != 1 || s.Max != 20 {
+		t.Errorf("union %+v, want count 5 mean 7.2 min 1 max 20", s)
+	}
+	if l.count("read") != 3 || l.count("write") != 2 || len(l.tags()) != 2 {
+		t.Errorf("union changed the tags: %q", l.tags())
+	}
+	if _, ok := l.SummaryUnion("absent"); ok {
+		t.Error("union of tags without samples reported a summary")
+	}
+}
+
+func TestStatsUnion(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("read", []float64{1, 3})
+	l.RecordBatch("write", []float64{5})
+	l.StatsUnion("read", "write")
+	l.StatsUnion("absent")
+	got := lines(stdout)
+	if len(got) != 2 {
+		t.Fatalf("printed %q", got)
+	}
+	if !strings.Contains(got[0], "[UNION read+write] count 3 ") || !strings.Contains(got[0], "mean 3.000000") {
+		t.Errorf("union line %q", got[0])
+	}
+	if !strings.Contains(got[1], "[UNION absent] no samples") {
+		t.Errorf("empty union line %q", got[1])
+	}
+}
+
+func TestOnStats(t *testing.T) {
+	l, _, _ := newTestLedge()
+	type call struct {
+		tag string
+		s   StatsSummary
+	}
+	var calls []call
+	l.OnStats(func(tag string, s StatsSummary) {
+		// Reading l again would deadlock if the callback ran under its lock.
+		l.samples(tag)
+		calls = append(calls, call{tag, s})
+	})
+	l.RecordBatch("a", []float64{1, 2, 3})
+	l.RecordBatch("b", []float64{10})
+	l.Stats("a")
+	l.StatsLine("b")
+	s, _ := l.Summary("a")
+	l.Stats("absent")
+	l.Summary("absent")
+	if len(calls) != 3 {
+		t.Fatalf("callback called %d times: %+v", len(calls), calls)
+	}
+	want := []string{"a", "b", "a"}
+	for i, c := range calls {
+		if c.tag != want[i] {
+			t.Errorf("call %d for %q, want %q", i, c.tag, want[i])
+		}
+	}
+	if calls[0].s != s || calls[0].s.Count != 3 || calls[0].s.Mean != 2 {
+		t.Errorf("Stats gave %+v, want %+v", calls[0].s, s)
+	}
+	if calls[1].s.Count != 1 || calls[1].s.Mean != 10 {
+		t.Errorf("StatsLine gave %+v", calls[1].s)
+	}
+}
+
+func TestSummaryDelta(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("op", []float64{1, 2, 3})
+	s, ok := l.SummaryDelta("op")
+	if !ok || s.Count != 3 || s.Mean != 2 {
+		t.Errorf("first delta %+v, %v", s, ok)
+	}
+	if _, ok := l.SummaryDelta("op"); ok {
+		t.Error("delta without new samples reported a summary")
+	}
+	l.RecordBatch("op", []float64{10, 20})
+	s, ok = l.SummaryDelta("op")
+	if !ok || s.Count != 2 || s.Mean != 15 || s.Min != 10 {
+		t.Errorf("second delta %+v, %v, want only the second phase", s, ok)
+	}
+	if l.count("op") != 5 {
+		t.Errorf("SummaryDelta changed the records: %d samples", l.count("op"))
+	}
+}
+
+func TestSummaryDeltaAfterClear(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("op", []float64{1, 2, 3})
+	l.SummaryDelta("op")
+	l.ClearRecords("op")
+	l.RecordBatch("op", []float64{7})
+	if s, ok := l.SummaryDelta("op"); !ok || s.Count != 1 || s.Mean != 7 {
+		t.Errorf("delta after clearing %+v, %v", s, ok)
+	}
+}
+
+func TestSummaryDeltaAfterClearAndRegrow(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("op", []float64{1, 2, 3})
+	l.SummaryDelta("op")
+	l.ClearRecords("op")
+	l.RecordBatch("op", []float64{7, 8, 9, 10, 11})
+	if s, ok := l.SummaryDelta("op"); !ok || s.Count != 5 || s.Mean != 9 {
+		t.Errorf("delta after clearing and recording more %+v, %v, want all 5 new samples", s, ok)
+	}
+}
+
+func TestSummaryDeltaAfterEviction(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.WithMemoryBudget(4 * sampleBytes)
+	l.RecordBatch("op", []float64{1, 2, 3})
+	l.SummaryDelta("op")
+	l.RecordBatch("other", []float64{1, 2})
+	l.RecordBatch("op", []float64{4, 5, 6, 7})
+	if s, ok := l.SummaryDelta("op"); !ok || s.Count != 4 || s.Min != 4 {
+		t.Errorf("delta after eviction %+v, %v, want the 4 new samples", s, ok)
+	}
+}
+
+func TestSummaryDeltaAfterNormalize(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("Renamed", []float64{1, 2})
+	l.RecordBatch("A", []float64{1, 2})
+	l.RecordBatch("a", []float64{3})
+	l.SummaryDelta("Renamed")
+	l.SummaryDelta("a")
+	l.WithTagNormalizer(strings.ToLower).NormalizeExistingTags()
+	l.RecordBatch("renamed", []float64{9})
+	if s, ok := l.SummaryDelta("renamed"); !ok || s.Count != 1 || s.Mean != 9 {
+		t.Errorf("delta of a renamed tag %+v, %v, want only the new sample", s, ok)
+	}
+	if s, ok := l.SummaryDelta("a"); !ok || s.Count != 3 {
+		t.Errorf("delta of a merged tag %+v, %v, want all 3 merged samples", s, ok)
+	}
+}
+
+func TestStatsDelta(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.RecordBatch("op", []float64{1, 3})
+	l.StatsDelta("op")
+	l.StatsDelta("op")
+	l.RecordBatch("op", []float64{8})
+	l.StatsDelta("op")
+	got := lines(stdout)
+	want := []string{"[DELTA op] count 2 ", "[DELTA op] no new samples", "[DELTA op] count 1 min 8.000000"}
+	if len(got) != len(want) {
+		t.Fatalf("printed %q", got)
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("line %q lacks %q", got[i], want[i])
+		}
+	}
+}
+
+func TestWithAutoSummary(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithAutoSummary(3)
+	for i := 1; i <= 10; i++ {
+		l.RecordValue("a", float64(i))
+	}
+	l.RecordValue("b", 1)
+	l.RecordValue("b", 1)
+	got := lines(stdout)
+	want := []string{"[STATS a] count 3 ", "[STATS a] count 6 ", "[STATS a] count 9 "}
+	if len(got) != len(want) {
+		t.Fatalf("printed %q", got)
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("line %q lacks %q", got[i], want[i])
+		}
+	}
+}
+
+func TestWithAutoSummaryBatch(t *testing.T) {
+	l, stdout, _ := newTestLedge()
+	l.WithAutoSummary(2)
+	l.RecordBatch("a", []float64{1})
+	l.RecordBatch("a", []float64{1, 2, 3, 4, 5})
+	got := lines(stdout)
+	if len(got) != 1 || !strings.Contains(got[0], "[STATS a] count 6 ") {
+		t.Errorf("printed %q, want one summary for the batch", got)
+	}
+}
+
+func TestStartIntervalReport(t *testing.T) {
+	l, _, _ := newTestLedge()
+	type report struct {
+		tag string
+		s   StatsSummary
+	}
+	reports := make(chan report, 10)
+	stop := l.StartIntervalReport(10*time.Millisecond, func(tag string, s StatsSummary) {
+		reports <- report{tag, s}
+	})
+	next := func() report {
+		t.Helper()
+		select {
+		case r := <-reports:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no report")
+			return report{}
+		}
+	}
+	l.RecordBatch("a", []float64{1, 3})
+	if r := next(); r.tag != "a" || r.s.Count != 2 || r.s.Mean != 2 {
+		t.Errorf("first interval %+v", r)
+	}
+	l.RecordBatch("a", []float64{10, 20, 30})
+	if r := next(); r.tag != "a" || r.s.Count != 3 || r.s.Mean != 20 {
+		t.Errorf("second interval %+v, want only its own samples", r)
+	}
+	stop()
+	stop()
+	l.RecordBatch("a", []float64{5})
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case r := <-reports:
+		t.Errorf("reported %+v after stop", r)
+	default:
+	}
+}
+
+func TestStartIntervalReportInvalidInterval(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	stop := l.StartIntervalReport(0, func(string, StatsSummary) {
+		t.Error("reported with an invalid interval")
+	})
+	stop()
+	if !strings.Contains(stderr.String(), "[ERROR] interval report: invalid interval 0s") {
+		t.Errorf("stderr = %q, want an error", stderr.String())
+	}
+}
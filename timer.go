@@ -0,0 +1,62 @@
+package ledge
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Timer measures a span that does not fit in a closure. Create one with
+// StartTimer and end it with Stop.
+type Timer struct {
+	l           *Ledge
+	tag         string
+	start       time.Time
+	concurrency *concurrency
+	stopped     int32
+}
+
+// StartTimer starts timing into tag until Stop is called on the result.
+func (l *Ledge) StartTimer(tag string) *Timer {
+	if l == nil {
+		return &Timer{tag: tag, start: time.Now()}
+	}
+	t := &Timer{l: l, tag: tag, start: time.Now(), concurrency: l.enter(tag)}
+	if l.timerLeakDetection {
+		runtime.SetFinalizer(t, func(t *Timer) {
+			if atomic.LoadInt32(&t.stopped) == 0 {
+				t.l.Errorf("timer for %s was garbage collected without being stopped", t.tag)
+			}
+		})
+	}
+	return t
+}
+
+// Stop records the time since StartTimer and returns it. Only the first call
+// records; later ones log a debug warning and return 0.
+func (t *Timer) Stop() time.Duration {
+	if !atomic.CompareAndSwapInt32(&t.stopped, 0, 1) {
+		t.l.Debugf("timer for %s stopped more than once", t.tag)
+		return 0
+	}
+	elapsed := time.Since(t.start)
+	if t.l == nil {
+		return elapsed
+	}
+	if t.l.timerLeakDetection {
+		runtime.SetFinalizer(t, nil)
+	}
+	t.concurrency.exit()
+	if t.l.stats.IsSet() {
+		t.l.recordElapsed(t.tag, elapsed)
+	}
+	return elapsed
+}
+
+// WithTimerLeakDetection logs an error whenever a Timer is garbage collected
+// without having been stopped, which catches forgotten timers at the cost of
+// a finalizer per timer. Call it before l is shared.
+func (l *Ledge) WithTimerLeakDetection() *Ledge {
+	l.timerLeakDetection = true
+	return l
+}
@@ -0,0 +1,64 @@
+package ledge
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimerDoubleStop(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.DebugOn()
+	timer := l.StartTimer("op")
+	if d := timer.Stop(); d <= 0 {
+		t.Errorf("first Stop returned %v", d)
+	}
+	if d := timer.Stop(); d != 0 {
+		t.Errorf("second Stop returned %v, want 0", d)
+	}
+	if got := l.count("op"); got != 1 {
+		t.Errorf("recorded %d samples, want 1", got)
+	}
+	if !strings.Contains(stderr.String(), "timer for op stopped more than once") {
+		t.Errorf("stderr = %q, want a debug warning", stderr.String())
+	}
+}
+
+func TestTimerNilLedge(t *testing.T) {
+	var l *Ledge
+	timer := l.StartTimer("op")
+	time.Sleep(time.Millisecond)
+	if d := timer.Stop(); d < time.Millisecond {
+		t.Errorf("Stop returned %v", d)
+	}
+	if d := timer.Stop(); d != 0 {
+		t.Errorf("second Stop returned %v, want 0", d)
+	}
+}
+
+// startTimers starts a timer into "leaked" that is dropped, and one into
+// "stopped" that is stopped, so that neither is reachable afterwards.
+func startTimers(l *Ledge) {
+	l.StartTimer("leaked")
+	l.StartTimer("stopped").Stop()
+}
+
+func TestTimerLeakDetection(t *testing.T) {
+	out := &lockedBuffer{}
+	l := New("test").WithOutput(out, out).WithTimerLeakDetection()
+	l.ColorOff()
+	l.StatsOn()
+	startTimers(l)
+	for i := 0; i < 100 && !strings.Contains(out.String(), "leaked"); i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := out.String()
+	if !strings.Contains(got, "[ERROR] timer for leaked was garbage collected without being stopped") {
+		t.Errorf("output %q, want a leak warning", got)
+	}
+	if strings.Contains(got, "stopped was garbage collected") {
+		t.Errorf("output %q warns about a stopped timer", got)
+	}
+}
@@ -0,0 +1,60 @@
+package ledge
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Trace collects debug lines that are only written out if the traced
+// operation fails. See WithTrace.
+type Trace struct {
+	lock   *sync.Mutex
+	lines  []string
+	failed bool
+}
+
+func (tr *Trace) Debugf(format string, v ...interface{}) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.lines = append(tr.lines, fmt.Sprintf(format, v...))
+}
+
+func (tr *Trace) Debugln(v ...interface{}) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.lines = append(tr.lines, fmt.Sprintln(v...))
+}
+
+// Fail marks the trace as failed so its lines are written when WithTrace
+// returns.
+func (tr *Trace) Fail() {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	tr.failed = true
+}
+
+// WithTrace runs f with a Trace that buffers its debug lines. The lines are
+// discarded if f returns normally, and written to stderr (whether or not
+// debugging is on) if f calls tr.Fail or panics. A panic is re-raised after
+// the lines are written.
+func (l *Ledge) WithTrace(f func(tr *Trace)) {
+	if l == nil {
+		f(&Trace{lock: &sync.Mutex{}})
+		return
+	}
+	tr := &Trace{lock: &sync.Mutex{}}
+	defer func() {
+		r := recover()
+		tr.lock.Lock()
+		if r != nil || tr.failed {
+			for _, line := range tr.lines {
+				l.emit(l.stderr, LevelDebug, nil, line)
+			}
+		}
+		tr.lock.Unlock()
+		if r != nil {
+			panic(r)
+		}
+	}()
+	f(tr)
+}
@@ -0,0 +1,46 @@
+package ledge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithTraceSuccess(t *testing.T) {
+	l, stdout, stderr := newTestLedge()
+	l.WithTrace(func(tr *Trace) {
+		tr.Debugf("step %d", 1)
+		tr.Debugln("step", 2)
+	})
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("successful trace wrote %q and %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestWithTraceFail(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	l.WithTrace(func(tr *Trace) {
+		tr.Debugf("step %d", 1)
+		tr.Debugln("step", 2)
+		tr.Fail()
+	})
+	got := lines(stderr)
+	if len(got) != 2 || !strings.HasSuffix(got[0], "[DEBUG] step 1") || !strings.HasSuffix(got[1], "[DEBUG] step 2") {
+		t.Errorf("failed trace wrote %q", got)
+	}
+}
+
+func TestWithTracePanic(t *testing.T) {
+	l, _, stderr := newTestLedge()
+	r := mustPanic(t, func() {
+		l.WithTrace(func(tr *Trace) {
+			tr.Debugf("before the panic")
+			panic("boom")
+		})
+	})
+	if r != "boom" {
+		t.Errorf("re-raised %v, want boom", r)
+	}
+	if !strings.Contains(stderr.String(), "before the panic") {
+		t.Errorf("panicking trace wrote %q", stderr.String())
+	}
+}
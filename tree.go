@@ -0,0 +1,69 @@
+package ledge
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// statsNode is one dotted segment of a tag namespace.
+type statsNode struct {
+	children map[string]*statsNode
+	samples  []float64
+}
+
+func (n *statsNode) child(segment string) *statsNode {
+	c, ok := n.children[segment]
+	if !ok {
+		c = &statsNode{children: make(map[string]*statsNode)}
+		n.children[segment] = c
+	}
+	return c
+}
+
+// all returns the samples of n and all of its descendants.
+func (n *statsNode) all() []float64 {
+	samples := append([]float64(nil), n.samples...)
+	for _, c := range n.children {
+		samples = append(samples, c.all()...)
+	}
+	return samples
+}
+
+// StatsTree writes the summaries of all tags as a tree split on dots, so that
+// http.get and http.post appear indented under http, whose summary covers
+// both of them (and any samples of http itself).
+func (l *Ledge) StatsTree(w io.Writer) error {
+	if l == nil {
+		return nil
+	}
+	root := &statsNode{children: make(map[string]*statsNode)}
+	for _, tag := range l.tags() {
+		n := root
+		for _, segment := range strings.Split(tag, ".") {
+			n = n.child(segment)
+		}
+		n.samples = append(n.samples, l.samples(tag)...)
+	}
+	return writeTree(w, root, 0)
+}
+
+func writeTree(w io.Writer, n *statsNode, depth int) error {
+	segments := make([]string, 0, len(n.children))
+	for segment := range n.children {
+		segments = append(segments, segment)
+	}
+	sort.Strings(segments)
+	for _, segment := range segments {
+		c := n.children[segment]
+		s := summarize(c.all())
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", strings.Repeat("  ", depth), segment, summaryFields(s)); err != nil {
+			return err
+		}
+		if err := writeTree(w, c, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package ledge
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStatsTree(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("http.get", []float64{1, 2, 3})
+	l.RecordBatch("http.post", []float64{10})
+	l.RecordBatch("http", []float64{4})
+	l.RecordBatch("db.query", []float64{5, 7})
+	var buf bytes.Buffer
+	if err := l.StatsTree(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"db count 2 ",
+		"  query count 2 ",
+		"http count 5 ",
+		"  get count 3 ",
+		"  post count 1 ",
+	}
+	got := lines(&buf)
+	if len(got) != len(want) {
+		t.Fatalf("tree %q", got)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("line %d = %q, want prefix %q", i, got[i], want[i])
+		}
+	}
+	if !strings.Contains(got[2], "mean 4.000000") {
+		t.Errorf("http line %q, want the mean over http and its children", got[2])
+	}
+}
+
+func TestStatsTreeDeep(t *testing.T) {
+	l, _, _ := newTestLedge()
+	l.RecordBatch("a.b.c", []float64{1})
+	l.RecordBatch("a.b.d", []float64{1})
+	var buf bytes.Buffer
+	l.StatsTree(&buf)
+	got := lines(&buf)
+	want := []string{"a count 2 ", "  b count 2 ", "    c count 1 ", "    d count 1 "}
+	if len(got) != len(want) {
+		t.Fatalf("tree %q", got)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("line %d = %q, want prefix %q", i, got[i], want[i])
+		}
+	}
+}